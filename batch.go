@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// Discord's limits on a single message.
+const (
+	maxMessageContent = 2000
+	maxMessageEmbeds  = 10
+)
+
+// batchCollectTimeout is how long to wait for the next notification of a
+// batch. The notifier delivers the notifications of a batch back to back, so
+// this only needs to cover the time between two deliveries.
+const batchCollectTimeout = 100 * time.Millisecond
+
+// receiveBatch returns first along with the notifications that are received
+// right after it, i.e. the rest of the batch that the notifier delivers.
+func receiveBatch(ctx context.Context, ch <-chan calendar.Notification, first calendar.Notification) []calendar.Notification {
+	notifications := []calendar.Notification{first}
+
+	timer := time.NewTimer(batchCollectTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return notifications
+		case <-timer.C:
+			return notifications
+		case n := <-ch:
+			notifications = append(notifications, n)
+			timer.Reset(batchCollectTimeout)
+		}
+	}
+}
+
+// batchable returns true if the notification may be combined with others into
+// a single message. Notifications that are handled specially, e.g. sent by
+// email or edited later, are always sent on their own.
+func (c *trackedCalendar) batchable(n calendar.Notification) bool {
+	if n.Kind != calendar.NotificationReminder || c.tracksSent() {
+		return false
+	}
+	if c.destination(n) != destinationWebhook {
+		return false
+	}
+	if countdown := c.Config.LiveCountdown.Duration(); countdown > 0 && n.Event.StartsAt.Sub(n.RemindedAt) <= countdown {
+		return false
+	}
+	return true
+}
+
+// batchNotifications groups the notifications by calendar, so that each group
+// is sent to a single webhook. A group only spans notifications that are due
+// within window of its first one. Groups are returned in the order of their
+// first notification.
+func batchNotifications(notifications []calendar.Notification, window time.Duration) [][]calendar.Notification {
+	var batches [][]calendar.Notification
+	// open maps calendars to the index of their latest batch.
+	open := make(map[calendar.Calendar]int)
+
+	for _, n := range notifications {
+		if i, ok := open[n.Calendar]; ok && n.RemindedAt.Sub(batches[i][0].RemindedAt) <= window {
+			batches[i] = append(batches[i], n)
+			continue
+		}
+		open[n.Calendar] = len(batches)
+		batches = append(batches, []calendar.Notification{n})
+	}
+
+	return batches
+}
+
+// combinedMessage is a message that combines Count notification messages.
+type combinedMessage struct {
+	webhook.ExecuteData
+	Count int
+}
+
+// combineMessages combines the messages of a batch into as few messages as
+// Discord allows. The contents are joined by newlines, and the webhook
+// identity and thread of the first message are used.
+func combineMessages(messages []*webhook.ExecuteData) []combinedMessage {
+	var combined []combinedMessage
+	var contents []string
+	var embedsLength int
+
+	flush := func() {
+		if len(combined) == 0 {
+			return
+		}
+		last := &combined[len(combined)-1]
+		last.Content = truncateText(strings.Join(contents, "\n"), maxMessageContent)
+		contents = nil
+	}
+
+	for _, message := range messages {
+		length := 0
+		for _, embed := range message.Embeds {
+			length += embed.Length()
+		}
+
+		if len(combined) == 0 ||
+			len(combined[len(combined)-1].Embeds)+len(message.Embeds) > maxMessageEmbeds ||
+			embedsLength+length > maxEmbedTotal {
+			flush()
+			combined = append(combined, combinedMessage{
+				ExecuteData: webhook.ExecuteData{
+					Username:  messages[0].Username,
+					AvatarURL: messages[0].AvatarURL,
+					ThreadID:  messages[0].ThreadID,
+				},
+			})
+			embedsLength = 0
+		}
+
+		last := &combined[len(combined)-1]
+		last.Embeds = append(last.Embeds, message.Embeds...)
+		last.Count++
+		embedsLength += length
+		if message.Content != "" {
+			contents = append(contents, message.Content)
+		}
+	}
+	flush()
+
+	return combined
+}
+
+// batchFlags returns the message flags for a batch of notifications. The
+// batch is only sent silently if all of its notifications would be.
+func (c *trackedCalendar) batchFlags(notifications []calendar.Notification) discord.MessageFlags {
+	for _, n := range notifications {
+		if c.messageFlags(n) == 0 {
+			return 0
+		}
+	}
+	return discord.SuppressNotifications
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestBatchNotifications(t *testing.T) {
+	work := &trackedCalendar{Position: 0}
+	home := &trackedCalendar{Position: 1}
+	at := time.Date(2024, time.January, 15, 8, 50, 0, 0, time.UTC)
+
+	notification := func(cal *trackedCalendar, summary string, d time.Duration) calendar.Notification {
+		return calendar.Notification{
+			Calendar:   cal,
+			Event:      calendar.Event{Summary: summary},
+			RemindedAt: at.Add(d),
+		}
+	}
+
+	batches := batchNotifications([]calendar.Notification{
+		notification(work, "standup", 0),
+		notification(home, "laundry", 0),
+		notification(work, "review", 30*time.Second),
+		notification(work, "lunch", 2*time.Minute),
+	}, time.Minute)
+
+	var got []string
+	for _, batch := range batches {
+		var summaries []string
+		for _, n := range batch {
+			summaries = append(summaries, n.Event.Summary)
+		}
+		got = append(got, strings.Join(summaries, "+"))
+	}
+
+	assert.Equal(t, []string{"standup+review", "laundry", "lunch"}, got)
+}
+
+func TestCombineMessages(t *testing.T) {
+	message := func(content string) *webhook.ExecuteData {
+		return &webhook.ExecuteData{
+			Content:  content,
+			Username: "Calendar",
+			Embeds:   []discord.Embed{{Title: content}},
+		}
+	}
+
+	var messages []*webhook.ExecuteData
+	for i := 0; i < 12; i++ {
+		messages = append(messages, message(strings.Repeat("x", i+1)))
+	}
+
+	combined := combineMessages(messages)
+	assert.Equal(t, 2, len(combined))
+
+	assert.Equal(t, 10, combined[0].Count)
+	assert.Equal(t, 10, len(combined[0].Embeds))
+	assert.Equal(t, "Calendar", combined[0].Username)
+	assert.True(t, strings.HasPrefix(combined[0].Content, "x\nxx\nxxx\n"))
+
+	assert.Equal(t, 2, combined[1].Count)
+	assert.Equal(t, 2, len(combined[1].Embeds))
+	assert.Equal(t, "Calendar", combined[1].Username)
+	assert.Equal(t, strings.Repeat("x", 11)+"\n"+strings.Repeat("x", 12), combined[1].Content)
+}
+
+func TestCombineMessages_embedsLength(t *testing.T) {
+	long := &webhook.ExecuteData{
+		Embeds: []discord.Embed{{Description: strings.Repeat("x", 4000)}},
+	}
+
+	// Two embeds this long exceed the total length of a message's embeds.
+	combined := combineMessages([]*webhook.ExecuteData{long, long})
+	assert.Equal(t, 2, len(combined))
+	assert.Equal(t, 1, combined[0].Count)
+	assert.Equal(t, 1, combined[1].Count)
+}
+
+func TestReceiveBatch(t *testing.T) {
+	ch := make(chan calendar.Notification)
+	go func() {
+		ch <- calendar.Notification{Event: calendar.Event{Summary: "second"}}
+		ch <- calendar.Notification{Event: calendar.Event{Summary: "third"}}
+	}()
+
+	batch := receiveBatch(context.Background(), ch, calendar.Notification{Event: calendar.Event{Summary: "first"}})
+	assert.Equal(t, 3, len(batch))
+	assert.Equal(t, "third", batch[2].Event.Summary)
+}
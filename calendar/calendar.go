@@ -2,6 +2,10 @@ package calendar
 
 import (
 	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-ical"
@@ -9,13 +13,167 @@ import (
 
 // Event is a calendar event.
 type Event struct {
+	// UID is the event's unique identifier. Recurring events share the same
+	// UID across occurrences.
+	UID         string
 	StartsAt    time.Time
 	EndsAt      time.Time
 	Summary     string // title
 	Location    string
+	URL         string
 	Description string
 	Status      EventStatus
 	Reminders   []Reminder
+	// Priority is the event's priority, ranging from 1 (highest) to 9
+	// (lowest). 0 means that the priority is undefined.
+	Priority int
+	// Sequence is the event's revision number. It is incremented every time
+	// the event is significantly changed, e.g. rescheduled.
+	Sequence int
+	// AllDay is true if the event spans whole days rather than starting at a
+	// time of day. StartsAt is then the start of its first day, which its
+	// reminders are relative to.
+	AllDay bool
+	// Organizer is the event's organizer, formatted like Attendee.String. It
+	// is empty if the event has no organizer.
+	Organizer string
+	// Attendees are the event's participants, in the order they are listed.
+	Attendees []Attendee
+	// Categories are the event's categories, e.g. "Meeting".
+	Categories []string
+	// Recurrence describes how the event repeats. It is nil if the event
+	// doesn't recur.
+	Recurrence *RecurrenceInfo
+	// RecurrenceID is the original start time of the occurrence of a
+	// recurring event that this event overrides. It is zero if the event
+	// doesn't override an occurrence.
+	RecurrenceID time.Time
+}
+
+// EventID identifies an event within a calendar: a single event, all
+// occurrences of a recurring event, or an overridden occurrence of one.
+type EventID struct {
+	UID string
+	// RecurrenceID is the Unix time of Event.RecurrenceID, or zero.
+	RecurrenceID int64
+}
+
+// ID returns the event's ID.
+func (e Event) ID() EventID {
+	id := EventID{UID: e.UID}
+	if !e.RecurrenceID.IsZero() {
+		id.RecurrenceID = e.RecurrenceID.Unix()
+	}
+	return id
+}
+
+// Attendee is a participant of an event.
+type Attendee struct {
+	// Name is the participant's common name. It may be empty.
+	Name string
+	// Email is the participant's email address. It is empty if the
+	// participant isn't identified by a mailto: URI.
+	Email string
+}
+
+// String formats the attendee like an email address, e.g.
+// "Jane Doe <jane@example.com>", leaving out the parts that are empty.
+func (a Attendee) String() string {
+	switch {
+	case a.Name == "":
+		return a.Email
+	case a.Email == "":
+		return a.Name
+	default:
+		return a.Name + " <" + a.Email + ">"
+	}
+}
+
+// RecurrenceInfo describes how a recurring event repeats, as given by its
+// recurrence rule.
+type RecurrenceInfo struct {
+	// Frequency is the unit of the recurrence, e.g. "WEEKLY" or "DAILY".
+	Frequency string
+	// Interval is the number of Frequency units between occurrences. It is
+	// at least 1.
+	Interval int
+	// Weekdays are the days of the week that the event occurs on, if the
+	// rule restricts them.
+	Weekdays []time.Weekday
+	// Until, if not zero, is the time after which the event stops repeating.
+	Until time.Time
+	// Count, if not zero, is the total number of occurrences.
+	Count int
+}
+
+var frequencyUnits = map[string]string{
+	"YEARLY":   "year",
+	"MONTHLY":  "month",
+	"WEEKLY":   "week",
+	"DAILY":    "day",
+	"HOURLY":   "hour",
+	"MINUTELY": "minute",
+	"SECONDLY": "second",
+}
+
+// String describes the recurrence in English, e.g. "Every 2 weeks on Monday
+// and Wednesday, 10 times".
+func (r RecurrenceInfo) String() string {
+	var s strings.Builder
+
+	unit, ok := frequencyUnits[r.Frequency]
+	if !ok {
+		unit = strings.ToLower(r.Frequency)
+	}
+
+	switch {
+	case r.Interval > 1:
+		fmt.Fprintf(&s, "Every %d %ss", r.Interval, unit)
+	case unit == "day":
+		s.WriteString("Daily")
+	case unit == "year" || unit == "month" || unit == "week" || unit == "hour":
+		s.WriteString(strings.ToUpper(unit[:1]) + unit[1:] + "ly")
+	default:
+		s.WriteString("Every " + unit)
+	}
+
+	if len(r.Weekdays) > 0 {
+		s.WriteString(" on " + formatWeekdays(r.Weekdays))
+	}
+
+	if r.Count > 0 {
+		if r.Count == 1 {
+			s.WriteString(", once")
+		} else {
+			fmt.Fprintf(&s, ", %d times", r.Count)
+		}
+	}
+	if !r.Until.IsZero() {
+		s.WriteString(", until " + r.Until.Format("January 2, 2006"))
+	}
+
+	return s.String()
+}
+
+// formatWeekdays joins the weekday names in English, e.g. "Monday, Tuesday
+// and Friday". Monday to Friday are shortened to "weekdays".
+func formatWeekdays(days []time.Weekday) string {
+	days = slices.Clone(days)
+	slices.Sort(days)
+	days = slices.Compact(days)
+
+	if slices.Equal(days, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}) {
+		return "weekdays"
+	}
+
+	names := make([]string, len(days))
+	for i, day := range days {
+		names[i] = day.String()
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
 }
 
 // CompareEvent compares two events by start time.
@@ -24,6 +182,17 @@ func CompareEvent(a, b Event) int { return CompareTime(a.StartsAt, b.StartsAt) }
 // CompareTime compares two times.
 func CompareTime(a, b time.Time) int { return cmp.Compare(a.UnixNano(), b.UnixNano()) }
 
+// DaysBetween returns the number of calendar days from a to b. The dates are
+// compared in their own locations, so DST transitions in between do not
+// affect the result.
+func DaysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	aDate := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	bDate := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(bDate.Sub(aDate) / Day)
+}
+
 // timeIncludes returns true if t is between start and end.
 func timeIncludes(start, end, t time.Time) bool {
 	return t.After(start) && t.Before(end)
@@ -120,6 +289,15 @@ type Calendar interface {
 	EventsBetween(start, end time.Time, opts EventsOpts) []Event
 }
 
+// EventLister is implemented by calendars that can list all of their events,
+// regardless of when they happen.
+type EventLister interface {
+	// EventIDs returns the IDs of all events of the calendar that have a UID.
+	// Floating recurrence IDs are in loc. It returns false if the calendar
+	// has not been loaded yet.
+	EventIDs(loc *time.Location) ([]EventID, bool)
+}
+
 // EventsWithin returns events that are happening within the given duration from
 // the given time.
 func EventsWithin(c Calendar, t time.Time, d time.Duration, opts EventsOpts) []Event {
@@ -137,30 +315,164 @@ type EventsOpts struct {
 	// DefaultReminderAction is the default reminder action to use for all
 	// default reminders. If empty, the action will be set to DISPLAY.
 	DefaultReminderAction ReminderAction
+	// DefaultRemindersMode determines which events get the default
+	// reminders. It defaults to DefaultRemindersAlways.
+	DefaultRemindersMode DefaultRemindersMode
 	// IncludeReminders will also search for events that have reminders that
 	// fall within the time range.
 	IncludeReminders bool
 	// ExcludeCancelled will exclude cancelled events.
 	ExcludeCancelled bool
+	// OnlyNearestReminder, if true, keeps only the latest reminder that is
+	// not after the event's start time, dropping all other reminders.
+	OnlyNearestReminder bool
+	// MinDuration, if non-zero, excludes events that are shorter than it.
+	MinDuration time.Duration
+	// MaxDuration, if non-zero, excludes events that are longer than it.
+	MaxDuration time.Duration
+	// IncludeVALARM, if true, adds reminders for the VALARM components of
+	// events, in addition to the parsed and default reminders.
+	IncludeVALARM bool
+	// IncludeCategories, if not empty, excludes events that have none of
+	// these categories. ExcludeCategories excludes events that have any of
+	// them. Categories are compared case-insensitively.
+	IncludeCategories []string
+	ExcludeCategories []string
+	// SummaryExclude, if not nil, excludes events whose summary matches it.
+	SummaryExclude *regexp.Regexp
+	// ReminderDestination, if not nil, returns where the reminders of the
+	// given action are delivered. Reminders at the same time are then
+	// deduplicated by destination rather than by action, so that e.g. a
+	// DISPLAY alarm and a default reminder that are both delivered to the
+	// same place are only sent once.
+	ReminderDestination func(ReminderAction) string
+}
+
+// DefaultRemindersMode determines which events get the default reminders.
+type DefaultRemindersMode string
+
+const (
+	// DefaultRemindersAlways adds the default reminders to all events.
+	DefaultRemindersAlways DefaultRemindersMode = "always"
+	// DefaultRemindersOnlyIfNoneParsed only adds the default reminders to
+	// events for which ParseReminder returns no reminders, so that reminders
+	// given in an event override the defaults.
+	DefaultRemindersOnlyIfNoneParsed DefaultRemindersMode = "only_if_none_parsed"
+)
+
+// allowsDuration returns true if an event with the given duration passes the
+// MinDuration and MaxDuration filters.
+func (o EventsOpts) allowsDuration(d time.Duration) bool {
+	if o.MinDuration > 0 && d < o.MinDuration {
+		return false
+	}
+	if o.MaxDuration > 0 && d > o.MaxDuration {
+		return false
+	}
+	return true
+}
+
+// allowsEvent returns true if an event with the given summary and categories
+// passes the category and summary filters.
+func (o EventsOpts) allowsEvent(summary string, categories []string) bool {
+	hasAny := func(filter []string) bool {
+		return slices.ContainsFunc(categories, func(category string) bool {
+			return slices.ContainsFunc(filter, func(f string) bool {
+				return strings.EqualFold(strings.TrimSpace(f), category)
+			})
+		})
+	}
+	if len(o.IncludeCategories) > 0 && !hasAny(o.IncludeCategories) {
+		return false
+	}
+	if hasAny(o.ExcludeCategories) {
+		return false
+	}
+	if o.SummaryExclude != nil && o.SummaryExclude.MatchString(summary) {
+		return false
+	}
+	return true
 }
 
 // EventReminders returns a list of reminders for the given event.
-// It is a helper function that collects reminders from the reminder parser and
-// the default reminders.
+// It is a helper function that collects the event's own reminders, reminders
+// from the reminder parser and the default reminders, depending on
+// DefaultRemindersMode.
 func (o EventsOpts) EventReminders(e Event) []Reminder {
 	reminderAction := o.DefaultReminderAction
 	if reminderAction == "" {
 		reminderAction = ReminderActionDisplay
 	}
 
-	reminders := NewRemindersFromDuration(e.StartsAt, o.DefaultReminders, reminderAction)
+	var parsed []Reminder
 	if o.ParseReminder != nil {
-		reminders = append(reminders, o.ParseReminder(e)...)
+		parsed = o.ParseReminder(e)
+	}
+
+	reminders := make([]Reminder, 0, len(e.Reminders)+len(o.DefaultReminders)+len(parsed))
+	reminders = append(reminders, e.Reminders...)
+	if len(parsed) == 0 || o.DefaultRemindersMode != DefaultRemindersOnlyIfNoneParsed {
+		reminders = append(reminders, NewRemindersFromDuration(e.StartsAt, o.DefaultReminders, reminderAction)...)
+	}
+	reminders = append(reminders, parsed...)
+
+	// The same reminder may come from multiple sources, e.g. a VALARM and a
+	// default reminder, but it should only be sent once.
+	reminders = dedupReminders(reminders, o.ReminderDestination)
+
+	if o.OnlyNearestReminder {
+		reminders = nearestReminder(e, reminders)
 	}
 
 	return reminders
 }
 
+// dedupReminders removes reminders with the same time and action as an earlier
+// reminder in the list, keeping the first one. If destination is not nil,
+// reminders with the same time and destination are removed instead.
+func dedupReminders(reminders []Reminder, destination func(ReminderAction) string) []Reminder {
+	type reminderKey struct {
+		Action      ReminderAction
+		Destination string
+		RemindAt    int64
+	}
+
+	seen := make(map[reminderKey]struct{}, len(reminders))
+	deduped := reminders[:0]
+	for _, r := range reminders {
+		k := reminderKey{Action: r.Action, RemindAt: r.RemindAt.UnixNano()}
+		if destination != nil {
+			k.Action = ""
+			k.Destination = destination(r.Action)
+		}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		deduped = append(deduped, r)
+	}
+	return deduped
+}
+
+// nearestReminder returns a list containing only the latest reminder that is
+// not after the event's start time. It returns an empty list if there is no
+// such reminder.
+func nearestReminder(e Event, reminders []Reminder) []Reminder {
+	nearest := -1
+	for i, r := range reminders {
+		if r.RemindAt.After(e.StartsAt) {
+			continue
+		}
+		if nearest == -1 || r.RemindAt.After(reminders[nearest].RemindAt) {
+			nearest = i
+		}
+	}
+	if nearest == -1 {
+		return []Reminder{}
+	}
+	return []Reminder{reminders[nearest]}
+}
+
 // ReminderParseFunc parses reminders from a given event.
 // This exists because the iCalendar specification does not define a standard
 // way to represent reminders. This function is called for every event to
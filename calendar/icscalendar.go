@@ -2,12 +2,18 @@ package calendar
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,14 +24,21 @@ import (
 // ICSCalendar represents a calendar. An ICSCalendar is immutable: once created,
 // it cannot be modified. It is safe to use from multiple goroutines.
 type ICSCalendar struct {
-	ical *ical.Calendar
+	ical  *ical.Calendar
+	zones map[string]*time.Location
 }
 
-var _ Calendar = (*ICSCalendar)(nil)
+var (
+	_ Calendar    = (*ICSCalendar)(nil)
+	_ EventLister = (*ICSCalendar)(nil)
+)
 
 // NewICS creates a new calendar from an ICS calendar.
 func NewICS(ical *ical.Calendar) *ICSCalendar {
-	return &ICSCalendar{ical: ical}
+	return &ICSCalendar{
+		ical:  ical,
+		zones: parseTimezones(ical),
+	}
 }
 
 // ParseICS parses an ICS-formatted calendar from r.
@@ -40,17 +53,81 @@ func ParseICS(r io.Reader) (*ICSCalendar, error) {
 
 func (c *ICSCalendar) createEvent(src ical.Event, start, end time.Time, opts EventsOpts) Event {
 	e := Event{
+		UID:         textProp(src.Props, ical.PropUID),
 		StartsAt:    start,
 		EndsAt:      end,
 		Summary:     textProp(src.Props, ical.PropSummary),
 		Location:    textProp(src.Props, ical.PropLocation),
+		URL:         textProp(src.Props, ical.PropURL),
 		Description: textProp(src.Props, ical.PropDescription),
+		Priority:    intProp(src.Props, ical.PropPriority),
+		Sequence:    intProp(src.Props, ical.PropSequence),
+		AllDay:      isAllDay(src),
+		Categories:  categoriesProp(src.Props),
+		Recurrence:  recurrenceInfo(src, start.Location()),
+	}
+	if prop := src.Props.Get(ical.PropRecurrenceID); prop != nil {
+		e.RecurrenceID, _ = c.dateTime(prop, start.Location())
+	}
+	if organizer := src.Props.Get(ical.PropOrganizer); organizer != nil {
+		e.Organizer = attendeeProp(organizer).String()
+	}
+	for i := range src.Props[ical.PropAttendee] {
+		e.Attendees = append(e.Attendees, attendeeProp(&src.Props[ical.PropAttendee][i]))
 	}
 	e.Status, _ = src.Status()
+	if opts.IncludeVALARM {
+		e.Reminders = alarmReminders(src, start, end)
+	}
 	e.Reminders = opts.EventReminders(e)
 	return e
 }
 
+// alarmReminders returns the reminders of the VALARM components of the event
+// that starts and ends at the given times. Alarms with an invalid TRIGGER are
+// ignored.
+func alarmReminders(src ical.Event, start, end time.Time) []Reminder {
+	var reminders []Reminder
+	for _, child := range src.Children {
+		if child.Name != ical.CompAlarm {
+			continue
+		}
+
+		trigger := child.Props.Get(ical.PropTrigger)
+		if trigger == nil {
+			continue
+		}
+
+		var remindAt time.Time
+		if trigger.ValueType() == ical.ValueDateTime {
+			t, err := trigger.DateTime(start.Location())
+			if err != nil {
+				continue
+			}
+			remindAt = t.In(start.Location())
+		} else {
+			d, err := trigger.Duration()
+			if err != nil {
+				continue
+			}
+			// Relative triggers are related to the start of the event unless
+			// specified otherwise.
+			anchor := start
+			if strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") {
+				anchor = end
+			}
+			remindAt = anchor.Add(d)
+		}
+
+		action := strings.ToUpper(textProp(child.Props, ical.PropAction))
+		reminders = append(reminders, Reminder{
+			Action:   ReminderAction(action),
+			RemindAt: remindAt,
+		})
+	}
+	return reminders
+}
+
 func textProp(props ical.Props, name string) string {
 	prop := props.Get(name)
 	if prop == nil {
@@ -60,6 +137,161 @@ func textProp(props ical.Props, name string) string {
 	return text
 }
 
+// categoriesProp returns the categories of all CATEGORIES properties, each
+// of which may list several.
+func categoriesProp(props ical.Props) []string {
+	var categories []string
+	for _, prop := range props[ical.PropCategories] {
+		list, err := prop.TextList()
+		if err != nil {
+			continue
+		}
+		for _, category := range list {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
+}
+
+// recurrenceInfo returns the recurrence of the event, or nil if it has no
+// valid RRULE. UNTIL is converted to loc.
+func recurrenceInfo(src ical.Event, loc *time.Location) *RecurrenceInfo {
+	roption, err := src.Props.RecurrenceRule()
+	if err != nil || roption == nil {
+		return nil
+	}
+
+	info := &RecurrenceInfo{
+		Frequency: roption.Freq.String(),
+		Interval:  roption.Interval,
+		Count:     roption.Count,
+	}
+	if info.Interval < 1 {
+		info.Interval = 1
+	}
+	if !roption.Until.IsZero() {
+		info.Until = localUntil(src.Props.Get(ical.PropRecurrenceRule).Value, roption.Until, loc).In(loc)
+	}
+	for _, wday := range roption.Byweekday {
+		// The rrule package counts weekdays from Monday.
+		info.Weekdays = append(info.Weekdays, time.Weekday((wday.Day()+1)%7))
+	}
+	return info
+}
+
+// localUntil reinterprets the UNTIL of a recurrence rule in loc if it is a
+// date or a floating time, which are in the event's timezone but are parsed
+// as UTC.
+func localUntil(rrule string, until time.Time, loc *time.Location) time.Time {
+	if until.IsZero() || strings.HasSuffix(strings.ToUpper(rrulePart(rrule, "UNTIL")), "Z") {
+		return until
+	}
+	return time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, loc)
+}
+
+// rrulePart returns the value of the given part of a recurrence rule, e.g.
+// "WEEKLY" for "FREQ".
+func rrulePart(rrule, name string) string {
+	for _, part := range strings.Split(rrule, ";") {
+		if key, value, _ := strings.Cut(part, "="); strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// attendeeProp parses an ORGANIZER or ATTENDEE property, e.g.
+// `ATTENDEE;CN="Jane Doe":mailto:jane@example.com`.
+func attendeeProp(prop *ical.Prop) Attendee {
+	a := Attendee{Name: prop.Params.Get(ical.ParamCommonName)}
+	if scheme, addr, ok := strings.Cut(prop.Value, ":"); ok && strings.EqualFold(scheme, "mailto") {
+		a.Email = addr
+	}
+	return a
+}
+
+func intProp(props ical.Props, name string) int {
+	prop := props.Get(name)
+	if prop == nil {
+		return 0
+	}
+	i, _ := strconv.Atoi(strings.TrimSpace(prop.Value))
+	return i
+}
+
+// recurrenceKey identifies an occurrence of a recurring event by its UID and
+// original start time.
+type recurrenceKey struct {
+	UID      string
+	StartsAt int64
+}
+
+// recurrenceOverrides returns the occurrences of recurring events that are
+// overridden by a separate VEVENT with a RECURRENCE-ID.
+func (c *ICSCalendar) recurrenceOverrides(location *time.Location) map[recurrenceKey]struct{} {
+	overrides := make(map[recurrenceKey]struct{})
+	for _, component := range c.ical.Children {
+		if component.Name != ical.CompEvent {
+			continue
+		}
+
+		prop := component.Props.Get(ical.PropRecurrenceID)
+		if prop == nil {
+			continue
+		}
+
+		recurrenceID, err := c.dateTime(prop, location)
+		if err != nil {
+			continue
+		}
+
+		uid := textProp(component.Props, ical.PropUID)
+		overrides[recurrenceKey{uid, recurrenceID.Unix()}] = struct{}{}
+	}
+	return overrides
+}
+
+// EventIDs implements EventLister.
+func (c *ICSCalendar) EventIDs(loc *time.Location) ([]EventID, bool) {
+	var ids []EventID
+	for _, component := range c.ical.Children {
+		if component.Name != ical.CompEvent {
+			continue
+		}
+
+		id := EventID{UID: textProp(component.Props, ical.PropUID)}
+		if id.UID == "" {
+			continue
+		}
+		if prop := component.Props.Get(ical.PropRecurrenceID); prop != nil {
+			if recurrenceID, err := c.dateTime(prop, loc); err == nil {
+				id.RecurrenceID = recurrenceID.Unix()
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// isAllDay returns true if the event's DTSTART is a date without a time,
+// either because it has VALUE=DATE or because of its format.
+func isAllDay(event ical.Event) bool {
+	prop := event.Props.Get(ical.PropDateTimeStart)
+	if prop == nil {
+		return false
+	}
+	switch prop.ValueType() {
+	case ical.ValueDate:
+		return true
+	case ical.ValueDefault:
+		return len(prop.Value) == len("20060102")
+	default:
+		return false
+	}
+}
+
 // Equals compares two calendars.
 func (c *ICSCalendar) Equals(x *ICSCalendar) bool {
 	if c == x {
@@ -83,8 +315,10 @@ func (c *ICSCalendar) Equals(x *ICSCalendar) bool {
 
 // EventsBetween implements Calendar.EventsBetween.
 func (c *ICSCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Event {
+	// Events are created in start's location, so normalize end into it to
+	// keep the range consistent.
 	if start.Location() != end.Location() {
-		panic("start and end must have the same location")
+		end = end.In(start.Location())
 	}
 
 	slog.Debug(
@@ -94,6 +328,7 @@ func (c *ICSCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Eve
 
 	location := start.Location()
 	chosenEvents := make([]Event, 0, 8)
+	overrides := c.recurrenceOverrides(location)
 
 	for _, component := range c.ical.Children {
 		if component.Name != ical.CompEvent {
@@ -109,23 +344,43 @@ func (c *ICSCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Eve
 			}
 		}
 
-		dtstart, err := icsEvent.DateTimeStart(location)
+		if !opts.allowsEvent(textProp(icsEvent.Props, ical.PropSummary), categoriesProp(icsEvent.Props)) {
+			continue
+		}
+
+		dtstart, err := c.dateTimeStart(icsEvent, location)
 		if err != nil {
 			continue
 		}
 
-		dtend, err := icsEvent.DateTimeEnd(location)
+		// Events without a DTEND end after their DURATION instead.
+		dtend, err := c.dateTimeEnd(icsEvent, location)
 		if err != nil {
 			continue
 		}
 
+		if !opts.allowsDuration(dtend.Sub(dtstart)) {
+			continue
+		}
+
 		event := c.createEvent(icsEvent, dtstart, dtend, opts)
 
-		// Prefer checking recurrence rules first.
+		// Prefer checking recurrence rules first. The recurrence set already
+		// excludes the occurrences listed in EXDATE.
 		// Interesting blog: https://www.nylas.com/blog/calendar-events-rrules/.
-		rrules, _ := icsEvent.RecurrenceSet(location)
+		rrules, err := c.recurrenceSet(icsEvent, location)
+		if err != nil {
+			slog.Warn(
+				"ics: skipping event with invalid recurrence",
+				"uid", event.UID,
+				"summary", event.Summary,
+				"error", err)
+			continue
+		}
 		if rrules != nil {
 			duration := dtend.Sub(dtstart)
+			allDay := isAllDay(icsEvent)
+			days := DaysBetween(dtstart, dtend)
 			rstart := start
 			rend := end
 
@@ -144,7 +399,22 @@ func (c *ICSCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Eve
 
 			// Copy the event for each relevant recurrence.
 			for _, startsAt := range rrules.Between(rstart, rend, true) {
-				event := c.createEvent(icsEvent, startsAt, startsAt.Add(duration), opts)
+				// Occurrences that were modified are described by their own
+				// VEVENT, which is handled separately.
+				if _, ok := overrides[recurrenceKey{event.UID, startsAt.Unix()}]; ok {
+					continue
+				}
+
+				endsAt := startsAt.Add(duration)
+				if allDay {
+					// All-day occurrences span whole calendar days. Adding a
+					// fixed duration would drift by an hour on DST days, so
+					// anchor both ends to local midnight instead.
+					startsAt = dayStart(startsAt)
+					endsAt = startsAt.AddDate(0, 0, days)
+				}
+
+				event := c.createEvent(icsEvent, startsAt, endsAt, opts)
 				chosenEvents = append(chosenEvents, event)
 			}
 		} else if event.Within(start, end, opts.IncludeReminders) {
@@ -158,20 +428,50 @@ func (c *ICSCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Eve
 	return chosenEvents
 }
 
-// OnlineICSCalendar represents an online calendar.
+// OnlineICSCalendar represents an online calendar. Its URL may also point to
+// a local file, either as a file:// URL or as a bare path.
 // It is safe for concurrent use.
 type OnlineICSCalendar struct {
 	// ICalURL is the URL to the ICS file.
 	ICalURL string
+	// Header contains additional headers to send when fetching the ICS file,
+	// e.g. for authentication.
+	Header http.Header
+	// Client is the HTTP client to fetch the ICS file with. If nil,
+	// DefaultHTTPClient is used.
+	Client *http.Client
 
 	ical atomic.Pointer[ICSCalendar]
+
+	// etag and lastModified are the validators of the last fetched calendar,
+	// used for conditional requests. fileModTime and fileSize are used
+	// instead for local files.
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	fileModTime  time.Time
+	fileSize     int64
+	// lastRefresh and lastErr are reported by LastRefresh.
+	lastRefresh time.Time
+	lastErr     error
 }
 
-var _ Calendar = (*OnlineICSCalendar)(nil)
+var (
+	_ Calendar    = (*OnlineICSCalendar)(nil)
+	_ EventLister = (*OnlineICSCalendar)(nil)
+)
+
+// DefaultFetchTimeout is the timeout of DefaultHTTPClient.
+const DefaultFetchTimeout = 30 * time.Second
 
-// NewOnlineICSCalendar creates a new online calendar tracking an ICS URL.
-func NewOnlineICSCalendar(icalURL string) *OnlineICSCalendar {
-	return &OnlineICSCalendar{ICalURL: icalURL}
+// DefaultHTTPClient is the HTTP client used by OnlineICSCalendars without a
+// Client. Unlike http.DefaultClient, it gives up on hung servers.
+var DefaultHTTPClient = &http.Client{Timeout: DefaultFetchTimeout}
+
+// NewOnlineICSCalendar creates a new online calendar tracking an ICS URL. The
+// given headers, which may be nil, are sent with every request.
+func NewOnlineICSCalendar(icalURL string, header http.Header) *OnlineICSCalendar {
+	return &OnlineICSCalendar{ICalURL: icalURL, Header: header}
 }
 
 // String implements fmt.Stringer.
@@ -181,42 +481,313 @@ func (c *OnlineICSCalendar) String() string {
 
 // Refresh attempts to refresh the calendar. It returns an error if the calendar
 // could not be updated. It returns true if the refreshed calendar is different
-// from the previous calendar.
+// from the previous calendar. If the server supports conditional requests, an
+// unchanged calendar is not downloaded again.
 //
 // Note that although this method is safe for concurrent use, it is not
 // guaranteed that the calendar is not updated multiple times concurrently.
 func (c *OnlineICSCalendar) Refresh(ctx context.Context) (changed bool, err error) {
+	changed, err = c.refresh(ctx)
+
+	c.mu.Lock()
+	if err == nil {
+		c.lastRefresh = time.Now()
+	}
+	c.lastErr = err
+	c.mu.Unlock()
+
+	return changed, err
+}
+
+// LastRefresh returns the time of the last successful refresh, which is zero
+// if the calendar was never loaded, and the error of the last refresh, which
+// is nil if it succeeded.
+func (c *OnlineICSCalendar) LastRefresh() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRefresh, c.lastErr
+}
+
+func (c *OnlineICSCalendar) refresh(ctx context.Context) (changed bool, err error) {
+	if path, ok := localPath(c.ICalURL); ok {
+		return c.refreshFile(path)
+	}
+
 	r, err := http.NewRequestWithContext(ctx, http.MethodGet, c.ICalURL, nil)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to create request")
 	}
 
-	resp, err := http.DefaultClient.Do(r)
+	for k, v := range c.Header {
+		r.Header[k] = v
+	}
+	// Setting this ourselves disables the transport's transparent
+	// decompression, so the body must be decompressed below.
+	if r.Header.Get("Accept-Encoding") == "" {
+		r.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	c.mu.Lock()
+	if c.etag != "" {
+		r.Header.Set("If-None-Match", c.etag)
+	}
+	if c.lastModified != "" {
+		r.Header.Set("If-Modified-Since", c.lastModified)
+	}
+	c.mu.Unlock()
+
+	client := c.Client
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+
+	resp, err := client.Do(r)
 	if err != nil {
-		return false, err
+		if ctx.Err() != nil {
+			return false, err
+		}
+		return false, &retryableError{err: err}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("unexpected status: %v", resp.Status)
+		err := errors.Errorf("unexpected status: %v", resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return false, &retryableError{
+				err:        err,
+				retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+		}
+		return false, err
 	}
 
-	newCalendar, err := ParseICS(resp.Body)
+	body := io.Reader(resp.Body)
+	// The transport may still have decompressed the body, e.g. if it was
+	// configured to request gzip itself, in which case it must not be
+	// decompressed again.
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to decompress calendar")
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	newCalendar, err := ParseICS(body)
 	if err != nil {
 		return false, errors.Wrap(err, "failed to parse calendar")
 	}
 
+	c.mu.Lock()
+	c.etag = resp.Header.Get("ETag")
+	c.lastModified = resp.Header.Get("Last-Modified")
+	c.mu.Unlock()
+
+	// Servers that don't support conditional requests always send the whole
+	// calendar, so compare it with the previous one.
+	return c.swap(newCalendar), nil
+}
+
+// swap replaces the calendar with newCalendar, returning true if it is
+// different from the previous one.
+func (c *OnlineICSCalendar) swap(newCalendar *ICSCalendar) bool {
 	oldCalendar := c.ical.Load()
 	if oldCalendar.Equals(newCalendar) {
-		return false, nil
+		return false
+	}
+	return c.ical.CompareAndSwap(oldCalendar, newCalendar)
+}
+
+// localPath returns the path to the calendar file if icalURL refers to a local
+// file, either as a file:// URL or as a bare path.
+func localPath(icalURL string) (string, bool) {
+	u, err := url.Parse(icalURL)
+	if err != nil {
+		// Bare paths may not be valid URLs.
+		return icalURL, !strings.Contains(icalURL, "://")
+	}
+	switch u.Scheme {
+	case "file":
+		return u.Path, true
+	case "":
+		return icalURL, true
+	default:
+		return "", false
+	}
+}
+
+// ValidateICalURL returns an error if icalURL can't be fetched by an
+// OnlineICSCalendar, which supports HTTP(S) URLs and local files.
+func ValidateICalURL(icalURL string) error {
+	if icalURL == "" {
+		return errors.New("must not be empty")
+	}
+	if _, ok := localPath(icalURL); ok {
+		return nil
 	}
 
-	swapped := c.ical.CompareAndSwap(oldCalendar, newCalendar)
-	if !swapped {
+	u, err := url.Parse(icalURL)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return errors.Errorf("unsupported scheme %q", u.Scheme)
+	case u.Host == "":
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// refreshFile refreshes the calendar from the local file at path. The file is
+// only read again if its modification time or size changed.
+func (c *OnlineICSCalendar) refreshFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to stat calendar file")
+	}
+
+	c.mu.Lock()
+	unchanged := c.ical.Load() != nil &&
+		info.ModTime().Equal(c.fileModTime) && info.Size() == c.fileSize
+	c.mu.Unlock()
+	if unchanged {
 		return false, nil
 	}
 
-	return true, nil
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to open calendar file")
+	}
+	defer f.Close()
+
+	newCalendar, err := ParseICS(f)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse calendar")
+	}
+
+	c.mu.Lock()
+	c.fileModTime = info.ModTime()
+	c.fileSize = info.Size()
+	c.mu.Unlock()
+
+	// The file may have been touched without changing its contents.
+	return c.swap(newCalendar), nil
+}
+
+// RetryOpts configures how RefreshWithRetry retries failed refreshes.
+type RetryOpts struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. It defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It is doubled
+	// after every retry. It defaults to 1 second.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries, including delays requested
+	// by the server using Retry-After. It defaults to 1 minute.
+	MaxBackoff time.Duration
+}
+
+func (o RetryOpts) withDefaults() RetryOpts {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Minute
+	}
+	return o
+}
+
+// RefreshWithRetry is like Refresh, but retries transient failures, such as
+// connection errors and 5xx or 429 responses, with exponential backoff. Other
+// errors are returned immediately. Retrying stops when ctx is done.
+func (c *OnlineICSCalendar) RefreshWithRetry(ctx context.Context, opts RetryOpts) (changed bool, err error) {
+	opts = opts.withDefaults()
+	backoff := opts.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		changed, err = c.Refresh(ctx)
+
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= opts.MaxAttempts {
+			return changed, err
+		}
+
+		delay := backoff
+		if retryable.retryAfter > delay {
+			delay = retryable.retryAfter
+		}
+		if delay > opts.MaxBackoff {
+			delay = opts.MaxBackoff
+		}
+
+		slog.DebugContext(ctx,
+			"ics: refresh failed, retrying",
+			"url", c.ICalURL,
+			"attempt", attempt,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// retryableError is returned by Refresh for failures that may go away if the
+// request is retried.
+type retryableError struct {
+	err error
+	// retryAfter is the delay requested by the server, if any.
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns 0 if the value is invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// EventIDs implements EventLister. It returns false if the calendar has not
+// been fetched yet.
+func (c *OnlineICSCalendar) EventIDs(loc *time.Location) ([]EventID, bool) {
+	ical := c.ical.Load()
+	if ical == nil {
+		return nil, false
+	}
+	return ical.EventIDs(loc)
 }
 
 // EventsBetween implements Calendar.EventsBetween. If Update has not been
@@ -1,6 +1,13 @@
 package calendar
 
 import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
@@ -18,6 +25,30 @@ var testICS string
 //go:embed test_no_rrules.ics
 var testNoRRulesICS string
 
+//go:embed test_valarm.ics
+var testVALARMICS string
+
+//go:embed test_exdate.ics
+var testEXDATEICS string
+
+//go:embed test_exdate_multi.ics
+var testEXDATEMultiICS string
+
+//go:embed test_recurrence_id.ics
+var testRecurrenceIDICS string
+
+//go:embed test_all_day_dst.ics
+var testAllDayDSTICS string
+
+//go:embed test_duration.ics
+var testDurationICS string
+
+//go:embed test_bounded.ics
+var testBoundedICS string
+
+//go:embed test_vtimezone.ics
+var testVTimezoneICS string
+
 var fixedTZ = time.FixedZone("America/Los_Angeles", -8*60*60)
 
 // testICSNow is intentionally in November to be near DST.
@@ -41,6 +72,7 @@ func TestICSCalendar(t *testing.T) {
 
 	expect := []Event{
 		{
+			UID:         "garbagegarbagegarbagegarbagegarbage@google.com",
 			StartsAt:    time.Date(2022, time.November, 1, 17, 00, 0, 0, losAngeles),
 			EndsAt:      time.Date(2022, time.November, 1, 19, 50, 0, 0, losAngeles),
 			Summary:     "GEOL 101L",
@@ -48,6 +80,13 @@ func TestICSCalendar(t *testing.T) {
 			Description: "",
 			Status:      "CONFIRMED",
 			Reminders:   []Reminder{},
+			Sequence:    2,
+			Recurrence: &RecurrenceInfo{
+				Frequency: "WEEKLY",
+				Interval:  1,
+				Weekdays:  []time.Weekday{time.Tuesday},
+				Until:     time.Date(2022, time.December, 13, 0, 0, 0, 0, losAngeles),
+			},
 		},
 	}
 
@@ -156,6 +195,909 @@ func TestICSCalendar_reminder(t *testing.T) {
 	})
 }
 
+func TestEventsOpts_dedupReminders(t *testing.T) {
+	event := Event{
+		StartsAt: time.Date(2022, time.November, 4, 9, 0, 0, 0, time.UTC),
+	}
+	event.Reminders = []Reminder{
+		{Action: ReminderActionDisplay, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+	}
+
+	opts := EventsOpts{
+		DefaultReminders: []time.Duration{15 * time.Minute, 1 * time.Hour},
+		ParseReminder: func(e Event) []Reminder {
+			return []Reminder{
+				{Action: ReminderActionDisplay, RemindAt: e.StartsAt.Add(-1 * time.Hour)},
+				{Action: ReminderActionEmail, RemindAt: e.StartsAt.Add(-1 * time.Hour)},
+			}
+		},
+	}
+
+	assert.Equal(t, []Reminder{
+		{Action: ReminderActionDisplay, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+		{Action: ReminderActionDisplay, RemindAt: event.StartsAt.Add(-1 * time.Hour)},
+		{Action: ReminderActionEmail, RemindAt: event.StartsAt.Add(-1 * time.Hour)},
+	}, opts.EventReminders(event))
+}
+
+func TestEventsOpts_defaultRemindersMode(t *testing.T) {
+	startsAt := time.Date(2022, time.November, 4, 9, 0, 0, 0, time.UTC)
+	parsed := Event{StartsAt: startsAt, Description: "Remind on Discord 5 minutes before"}
+	unparsed := Event{StartsAt: startsAt}
+
+	opts := EventsOpts{
+		DefaultReminders: []time.Duration{1 * time.Hour},
+		ParseReminder: func(e Event) []Reminder {
+			if e.Description == "" {
+				return nil
+			}
+			return []Reminder{
+				{Action: "DISCORD", RemindAt: e.StartsAt.Add(-5 * time.Minute)},
+			}
+		},
+	}
+
+	defaultReminder := Reminder{Action: ReminderActionDisplay, RemindAt: startsAt.Add(-1 * time.Hour)}
+	parsedReminder := Reminder{Action: "DISCORD", RemindAt: startsAt.Add(-5 * time.Minute)}
+
+	for _, mode := range []DefaultRemindersMode{"", DefaultRemindersAlways} {
+		opts.DefaultRemindersMode = mode
+		assert.Equal(t, []Reminder{defaultReminder, parsedReminder}, opts.EventReminders(parsed))
+		assert.Equal(t, []Reminder{defaultReminder}, opts.EventReminders(unparsed))
+	}
+
+	opts.DefaultRemindersMode = DefaultRemindersOnlyIfNoneParsed
+	assert.Equal(t, []Reminder{parsedReminder}, opts.EventReminders(parsed))
+	assert.Equal(t, []Reminder{defaultReminder}, opts.EventReminders(unparsed))
+}
+
+func TestEventsOpts_dedupRemindersByDestination(t *testing.T) {
+	event := Event{
+		StartsAt: time.Date(2022, time.November, 4, 9, 0, 0, 0, time.UTC),
+	}
+	// A VALARM 15 minutes before the event.
+	event.Reminders = []Reminder{
+		{Action: ReminderActionDisplay, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+		{Action: ReminderActionEmail, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+	}
+
+	opts := EventsOpts{
+		DefaultReminders:      []time.Duration{15 * time.Minute},
+		DefaultReminderAction: "DISCORD",
+		ReminderDestination: func(action ReminderAction) string {
+			if action == ReminderActionEmail {
+				return "email"
+			}
+			return "webhook"
+		},
+	}
+
+	assert.Equal(t, []Reminder{
+		{Action: ReminderActionDisplay, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+		{Action: ReminderActionEmail, RemindAt: event.StartsAt.Add(-15 * time.Minute)},
+	}, opts.EventReminders(event))
+
+	// Without destinations, the actions differ.
+	opts.ReminderDestination = nil
+	assert.Equal(t, 3, len(opts.EventReminders(event)))
+}
+
+func TestICSCalendar_onlyNearestReminder(t *testing.T) {
+	now := testICSNow
+
+	cal, err := ParseICS(strings.NewReader(testICS))
+	assert.NoError(t, err)
+
+	opts := EventsOpts{
+		IncludeReminders:    true,
+		OnlyNearestReminder: true,
+		DefaultReminders: []time.Duration{
+			1 * time.Hour,
+			10 * time.Minute,
+			1 * Day,
+		},
+	}
+
+	events := cal.EventsBetween(now, now.Add(1*Day), opts)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, []Reminder{
+		{
+			Action:   ReminderActionDisplay,
+			RemindAt: events[0].StartsAt.Add(-10 * time.Minute),
+		},
+	}, events[0].Reminders)
+}
+
+func TestICSCalendar_durationFilter(t *testing.T) {
+	now := testICSNow
+
+	cal, err := ParseICS(strings.NewReader(testICS))
+	assert.NoError(t, err)
+
+	// The event lasts 2 hours and 50 minutes.
+	tests := []struct {
+		name   string
+		opts   EventsOpts
+		expect int
+	}{
+		{"unfiltered", EventsOpts{}, 1},
+		{"max_too_short", EventsOpts{MaxDuration: 1 * time.Hour}, 0},
+		{"max_long_enough", EventsOpts{MaxDuration: 3 * time.Hour}, 1},
+		{"min_too_long", EventsOpts{MinDuration: 3 * time.Hour}, 0},
+		{"min_short_enough", EventsOpts{MinDuration: 1 * time.Hour}, 1},
+		{"range", EventsOpts{MinDuration: 1 * time.Hour, MaxDuration: 3 * time.Hour}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := cal.EventsBetween(now, now.Add(1*Day), test.opts)
+			assert.Equal(t, test.expect, len(events))
+		})
+	}
+}
+
+func TestICSCalendar_mismatchedLocations(t *testing.T) {
+	cal, err := ParseICS(strings.NewReader(testICS))
+	assert.NoError(t, err)
+
+	start := testICSNow
+	end := start.Add(1 * Day).UTC()
+
+	expect := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{})
+	events := cal.EventsBetween(start, end, EventsOpts{})
+	assert.Equal(t, expect, events)
+}
+
+func TestICSCalendar_allDayAcrossDST(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testAllDayDSTICS))
+	assert.NoError(t, err)
+
+	// DST ends on November 6, 2022, so that day is 25 hours long.
+	start := time.Date(2022, time.November, 4, 0, 0, 0, 0, losAngeles)
+	events := cal.EventsBetween(start, start.AddDate(0, 0, 4), EventsOpts{})
+	assert.Equal(t, 4, len(events))
+
+	for i, event := range events {
+		day := start.AddDate(0, 0, i)
+		assert.Equal(t, day, event.StartsAt)
+		assert.Equal(t, day.AddDate(0, 0, 1), event.EndsAt)
+		assert.True(t, event.AllDay)
+	}
+}
+
+func TestICSCalendar_valarm(t *testing.T) {
+	cal, err := ParseICS(strings.NewReader(testVALARMICS))
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2022, time.November, 1, 17, 0, 0, 0, time.UTC)
+	start := startsAt.Add(-1 * Day)
+
+	t.Run("excluded", func(t *testing.T) {
+		events := cal.EventsBetween(start, start.Add(2*Day), EventsOpts{})
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, 0, len(events[0].Reminders))
+	})
+
+	t.Run("included", func(t *testing.T) {
+		events := cal.EventsBetween(start, start.Add(2*Day), EventsOpts{IncludeVALARM: true})
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, []Reminder{
+			{Action: ReminderActionDisplay, RemindAt: startsAt.Add(-15 * time.Minute)},
+			{Action: ReminderActionAudio, RemindAt: startsAt.Add(55 * time.Minute)},
+			{Action: ReminderActionEmail, RemindAt: startsAt.Add(-1 * Day)},
+		}, events[0].Reminders)
+	})
+}
+
+func TestICSCalendar_exdate(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testEXDATEICS))
+	assert.NoError(t, err)
+
+	start := time.Date(2022, time.October, 1, 0, 0, 0, 0, losAngeles)
+	events := cal.EventsBetween(start, start.AddDate(0, 1, 0), EventsOpts{})
+
+	startTimes := make([]time.Time, len(events))
+	for i, event := range events {
+		startTimes[i] = event.StartsAt
+	}
+
+	// October 11 and 25 are excluded.
+	assert.Equal(t, []time.Time{
+		time.Date(2022, time.October, 4, 17, 0, 0, 0, losAngeles),
+		time.Date(2022, time.October, 18, 17, 0, 0, 0, losAngeles),
+	}, startTimes)
+}
+
+func TestICSCalendar_exdateMultiValue(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testEXDATEMultiICS))
+	assert.NoError(t, err)
+
+	start := time.Date(2022, time.October, 1, 0, 0, 0, 0, losAngeles)
+	events := cal.EventsBetween(start, start.AddDate(0, 1, 0), EventsOpts{})
+
+	startTimes := make(map[string][]time.Time)
+	for _, event := range events {
+		startTimes[event.UID] = append(startTimes[event.UID], event.StartsAt)
+	}
+
+	// October 11 and 25 are excluded.
+	assert.Equal(t, []time.Time{
+		time.Date(2022, time.October, 4, 17, 0, 0, 0, time.UTC),
+		time.Date(2022, time.October, 18, 17, 0, 0, 0, time.UTC),
+	}, startTimes["exdate-utc@example.com"])
+
+	// October 13 and 27 are excluded.
+	assert.Equal(t, []time.Time{
+		time.Date(2022, time.October, 6, 9, 0, 0, 0, losAngeles),
+		time.Date(2022, time.October, 20, 9, 0, 0, 0, losAngeles),
+	}, startTimes["exdate-tzid@example.com"])
+}
+
+func TestICSCalendar_recurrenceID(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testRecurrenceIDICS))
+	assert.NoError(t, err)
+
+	t.Run("overridden", func(t *testing.T) {
+		start := time.Date(2022, time.October, 18, 0, 0, 0, 0, losAngeles)
+		events := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{})
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, "Standup (moved)", events[0].Summary)
+		assert.Equal(t, time.Date(2022, time.October, 18, 14, 0, 0, 0, losAngeles), events[0].StartsAt)
+		assert.Equal(t, time.Date(2022, time.October, 18, 10, 0, 0, 0, losAngeles), events[0].RecurrenceID)
+	})
+
+	t.Run("not_overridden", func(t *testing.T) {
+		start := time.Date(2022, time.October, 25, 0, 0, 0, 0, losAngeles)
+		events := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{})
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, "Standup", events[0].Summary)
+		assert.Equal(t, time.Date(2022, time.October, 25, 10, 0, 0, 0, losAngeles), events[0].StartsAt)
+		assert.True(t, events[0].RecurrenceID.IsZero())
+	})
+
+	t.Run("ids", func(t *testing.T) {
+		ids, ok := cal.EventIDs(losAngeles)
+		assert.True(t, ok)
+		assert.Equal(t, []EventID{
+			{UID: "standup@example.com"},
+			{
+				UID:          "standup@example.com",
+				RecurrenceID: time.Date(2022, time.October, 18, 10, 0, 0, 0, losAngeles).Unix(),
+			},
+		}, ids)
+	})
+}
+
+func TestICSCalendar_duration(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testDurationICS))
+	assert.NoError(t, err)
+
+	// The event has a DURATION but no DTEND.
+	start := time.Date(2022, time.October, 4, 0, 0, 0, 0, losAngeles)
+	events := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{})
+	assert.Equal(t, 1, len(events))
+
+	startsAt := time.Date(2022, time.October, 4, 17, 0, 0, 0, losAngeles)
+	assert.Equal(t, startsAt, events[0].StartsAt)
+	assert.Equal(t, startsAt.Add(90*time.Minute), events[0].EndsAt)
+}
+
+func TestICSCalendar_boundedRecurrence(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testBoundedICS))
+	assert.NoError(t, err)
+
+	// A week-long reminder stretches the search window well past the end of
+	// every series.
+	opts := EventsOpts{
+		IncludeReminders: true,
+		DefaultReminders: []time.Duration{7 * Day},
+	}
+
+	start := time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)
+	occurrences := make(map[string][]time.Time)
+	for _, event := range cal.EventsBetween(start, start.AddDate(0, 3, 0), opts) {
+		occurrences[event.UID] = append(occurrences[event.UID], event.StartsAt)
+	}
+
+	tests := []struct {
+		uid    string
+		expect []time.Time
+	}{
+		{
+			"count@example.com",
+			[]time.Time{
+				time.Date(2022, time.November, 1, 17, 0, 0, 0, time.UTC),
+				time.Date(2022, time.November, 8, 17, 0, 0, 0, time.UTC),
+				time.Date(2022, time.November, 15, 17, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"until-utc@example.com",
+			[]time.Time{
+				time.Date(2022, time.December, 1, 17, 0, 0, 0, time.UTC),
+				time.Date(2022, time.December, 8, 17, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// UNTIL is a local time, so the occurrence an hour after it is
+			// excluded even though it is before UNTIL in UTC.
+			"until-local@example.com",
+			[]time.Time{
+				time.Date(2022, time.December, 1, 9, 0, 0, 0, tokyo),
+				time.Date(2022, time.December, 8, 9, 0, 0, 0, tokyo),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uid, func(t *testing.T) {
+			got := occurrences[test.uid]
+			assert.Equal(t, len(test.expect), len(got), "occurrences: %v", got)
+			for i := range test.expect {
+				if i < len(got) {
+					assert.True(t, test.expect[i].Equal(got[i]), "occurrence %d: %v", i, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestICSCalendar_vtimezone(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	cal, err := ParseICS(strings.NewReader(testVTimezoneICS))
+	assert.NoError(t, err)
+
+	// Neither TZID is known to the system, so both zones come from the
+	// calendar's VTIMEZONE components. The weekly event crosses the end of
+	// DST on November 6, but stays at 9 AM local time.
+	start := time.Date(2022, time.October, 31, 0, 0, 0, 0, losAngeles)
+	events := cal.EventsBetween(start, start.Add(14*Day), EventsOpts{})
+	assert.Equal(t, 3, len(events))
+
+	var weekly []time.Time
+	for _, event := range events {
+		switch event.UID {
+		case "vtimezone-weekly@example.com":
+			weekly = append(weekly, event.StartsAt)
+		case "vtimezone-fixed@example.com":
+			startsAt := time.Date(2022, time.November, 2, 4, 30, 0, 0, time.UTC)
+			assert.True(t, startsAt.Equal(event.StartsAt), "fixed zone start: %v", event.StartsAt)
+		}
+	}
+
+	assert.Equal(t, 2, len(weekly))
+	assert.Equal(t, &RecurrenceInfo{Frequency: "WEEKLY", Interval: 1, Count: 4}, events[0].Recurrence)
+	for i, day := range []int{1, 8} {
+		startsAt := time.Date(2022, time.November, day, 9, 0, 0, 0, losAngeles)
+		assert.True(t, startsAt.Equal(weekly[i]), "occurrence %d: %v", i, weekly[i])
+	}
+}
+
+func TestICSCalendar_attendees(t *testing.T) {
+	tests := []struct {
+		name      string
+		props     string
+		organizer string
+		attendees []Attendee
+	}{
+		{
+			name: "quoted_name",
+			props: "ORGANIZER;CN=\"Doe, Jane\":mailto:jane@example.com\n" +
+				"ATTENDEE;CN=John Smith;PARTSTAT=ACCEPTED:MAILTO:john@example.com\n" +
+				"ATTENDEE:mailto:anon@example.com\n" +
+				"ATTENDEE;CN=Room 1:urn:uuid:6f8b2f4e\n",
+			organizer: "Doe, Jane <jane@example.com>",
+			attendees: []Attendee{
+				{Name: "John Smith", Email: "john@example.com"},
+				{Email: "anon@example.com"},
+				{Name: "Room 1"},
+			},
+		},
+		{
+			name: "no_organizer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cal, err := ParseICS(strings.NewReader("BEGIN:VCALENDAR\n" +
+				"VERSION:2.0\n" +
+				"PRODID:-//Test//Test//EN\n" +
+				"BEGIN:VEVENT\n" +
+				"UID:attendees@example.com\n" +
+				"DTSTAMP:20221025T095847Z\n" +
+				"DTSTART:20221101T170000Z\n" +
+				"DTEND:20221101T180000Z\n" +
+				test.props +
+				"END:VEVENT\n" +
+				"END:VCALENDAR\n"))
+			assert.NoError(t, err)
+
+			start := time.Date(2022, time.November, 1, 0, 0, 0, 0, time.UTC)
+			events := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{})
+			assert.Equal(t, 1, len(events))
+			assert.Equal(t, test.organizer, events[0].Organizer)
+			assert.Equal(t, test.attendees, events[0].Attendees)
+		})
+	}
+}
+
+func TestICSCalendar_filter(t *testing.T) {
+	event := func(uid, summary, categories string) string {
+		s := "BEGIN:VEVENT\n" +
+			"UID:" + uid + "\n" +
+			"DTSTAMP:20221025T095847Z\n" +
+			"DTSTART:20221101T170000Z\n" +
+			"DTEND:20221101T180000Z\n" +
+			"SUMMARY:" + summary + "\n"
+		if categories != "" {
+			s += "CATEGORIES:" + categories + "\n"
+		}
+		return s + "END:VEVENT\n"
+	}
+
+	cal, err := ParseICS(strings.NewReader("BEGIN:VCALENDAR\n" +
+		"VERSION:2.0\n" +
+		"PRODID:-//Test//Test//EN\n" +
+		event("meeting", "Planning", "Meeting,Work") +
+		event("focus", "Focus time", "") +
+		event("ooo", "Vacation", "Out of office") +
+		"END:VCALENDAR\n"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		opts   EventsOpts
+		expect []string
+	}{
+		{"unfiltered", EventsOpts{}, []string{"meeting", "focus", "ooo"}},
+		{"include", EventsOpts{IncludeCategories: []string{"work"}}, []string{"meeting"}},
+		{"exclude", EventsOpts{ExcludeCategories: []string{"Out of Office"}}, []string{"meeting", "focus"}},
+		{"summary", EventsOpts{SummaryExclude: regexp.MustCompile(`^Focus`)}, []string{"meeting", "ooo"}},
+	}
+
+	start := time.Date(2022, time.November, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var uids []string
+			for _, event := range cal.EventsBetween(start, start.Add(1*Day), test.opts) {
+				uids = append(uids, event.UID)
+			}
+			assert.Equal(t, test.expect, uids)
+		})
+	}
+
+	events := cal.EventsBetween(start, start.Add(1*Day), EventsOpts{IncludeCategories: []string{"Meeting"}})
+	assert.Equal(t, []string{"Meeting", "Work"}, events[0].Categories)
+}
+
+func TestRecurrenceInfo_String(t *testing.T) {
+	until := time.Date(2022, time.December, 13, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		info   RecurrenceInfo
+		expect string
+	}{
+		{"daily", RecurrenceInfo{Frequency: "DAILY", Interval: 1}, "Daily"},
+		{"every_2_weeks", RecurrenceInfo{Frequency: "WEEKLY", Interval: 2}, "Every 2 weeks"},
+		{"every_minute", RecurrenceInfo{Frequency: "MINUTELY", Interval: 1}, "Every minute"},
+		{
+			"weekly_on_day",
+			RecurrenceInfo{Frequency: "WEEKLY", Interval: 1, Weekdays: []time.Weekday{time.Tuesday}},
+			"Weekly on Tuesday",
+		},
+		{
+			"weekly_on_days",
+			RecurrenceInfo{
+				Frequency: "WEEKLY",
+				Interval:  1,
+				Weekdays:  []time.Weekday{time.Friday, time.Monday, time.Wednesday},
+			},
+			"Weekly on Monday, Wednesday and Friday",
+		},
+		{
+			"weekdays",
+			RecurrenceInfo{
+				Frequency: "WEEKLY",
+				Interval:  1,
+				Weekdays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+			},
+			"Weekly on weekdays",
+		},
+		{"count", RecurrenceInfo{Frequency: "MONTHLY", Interval: 1, Count: 10}, "Monthly, 10 times"},
+		{"until", RecurrenceInfo{Frequency: "YEARLY", Interval: 1, Until: until}, "Yearly, until December 13, 2022"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, test.info.String())
+		})
+	}
+}
+
+func TestParseUTCOffset(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect int
+		err    bool
+	}{
+		{"-0800", -8 * 3600, false},
+		{"+0530", 5*3600 + 30*60, false},
+		{"+013045", 3600 + 30*60 + 45, false},
+		{"0800", 0, true},
+		{"+08", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			offset, err := parseUTCOffset(test.in)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expect, offset)
+		})
+	}
+}
+
+func TestOnlineICSCalendar_conditionalRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		condition string
+	}{
+		{"etag", "ETag", `"v1"`, "If-None-Match"},
+		{"last_modified", "Last-Modified", "Tue, 01 Nov 2022 00:00:00 GMT", "If-Modified-Since"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests, notModified int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Header.Get(test.condition) == test.value {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set(test.header, test.value)
+				io.WriteString(w, testICS)
+			}))
+			defer server.Close()
+
+			cal := NewOnlineICSCalendar(server.URL, nil)
+
+			changed, err := cal.Refresh(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, changed)
+
+			changed, err = cal.Refresh(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, changed)
+
+			assert.Equal(t, 2, requests)
+			assert.Equal(t, 1, notModified)
+
+			events := cal.EventsBetween(testICSNow, testICSNow.Add(1*Day), EventsOpts{})
+			assert.Equal(t, 1, len(events))
+		})
+	}
+}
+
+func TestOnlineICSCalendar_gzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(w, testICS)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, testICS)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	cal := NewOnlineICSCalendar(server.URL, nil)
+	changed, err := cal.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	events := cal.EventsBetween(testICSNow, testICSNow.Add(1*Day), EventsOpts{})
+	assert.Equal(t, 1, len(events))
+}
+
+func TestOnlineICSCalendar_client(t *testing.T) {
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	cal := NewOnlineICSCalendar(server.URL, nil)
+	cal.Client = &http.Client{Timeout: 50 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := cal.Refresh(ctx)
+	assert.Error(t, err)
+	// The client gave up, not the context.
+	assert.NoError(t, ctx.Err())
+}
+
+func TestOnlineICSCalendar_lastRefresh(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, testICS)
+	}))
+	defer server.Close()
+
+	cal := NewOnlineICSCalendar(server.URL, nil)
+	lastRefresh, err := cal.LastRefresh()
+	assert.True(t, lastRefresh.IsZero())
+	assert.NoError(t, err)
+
+	_, err = cal.Refresh(context.Background())
+	assert.NoError(t, err)
+
+	lastRefresh, err = cal.LastRefresh()
+	assert.False(t, lastRefresh.IsZero())
+	assert.NoError(t, err)
+
+	fail = true
+	_, err = cal.Refresh(context.Background())
+	assert.Error(t, err)
+
+	failedRefresh, err := cal.LastRefresh()
+	assert.Equal(t, lastRefresh, failedRefresh)
+	assert.Error(t, err)
+}
+
+func TestOnlineICSCalendar_header(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, testICS)
+	}))
+	defer server.Close()
+
+	_, err := NewOnlineICSCalendar(server.URL, nil).Refresh(context.Background())
+	assert.Error(t, err)
+
+	cal := NewOnlineICSCalendar(server.URL, http.Header{"Authorization": {"Bearer secret"}})
+	changed, err := cal.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestOnlineICSCalendar_retry(t *testing.T) {
+	opts := RetryOpts{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		expectErr    bool
+		expectTries  int
+		expectChange bool
+	}{
+		{"ok", []int{200}, false, 1, true},
+		{"server_error", []int{503, 502, 200}, false, 3, true},
+		{"rate_limited", []int{429, 200}, false, 2, true},
+		{"not_found", []int{404, 200}, true, 1, false},
+		{"gives_up", []int{500, 500, 500, 200}, true, 3, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tries int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.statuses[tries]
+				tries++
+				if status != http.StatusOK {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(status)
+					return
+				}
+				io.WriteString(w, testICS)
+			}))
+			defer server.Close()
+
+			cal := NewOnlineICSCalendar(server.URL, nil)
+
+			changed, err := cal.RefreshWithRetry(context.Background(), opts)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectChange, changed)
+			assert.Equal(t, test.expectTries, tries)
+		})
+	}
+}
+
+func TestOnlineICSCalendar_localFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	assert.NoError(t, os.WriteFile(path, []byte(testICS), 0644))
+
+	for _, icalURL := range []string{path, "file://" + path} {
+		t.Run(icalURL, func(t *testing.T) {
+			cal := NewOnlineICSCalendar(icalURL, nil)
+
+			changed, err := cal.Refresh(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, changed)
+
+			changed, err = cal.Refresh(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, changed)
+		})
+	}
+
+	cal := NewOnlineICSCalendar(path, nil)
+	_, err := cal.Refresh(context.Background())
+	assert.NoError(t, err)
+
+	// Touching the file without changing it is not a change.
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	changed, err := cal.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Changing the file is.
+	assert.NoError(t, os.WriteFile(path, []byte(testNoRRulesICS), 0644))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	changed, err = cal.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	_, err = NewOnlineICSCalendar(filepath.Join(t.TempDir(), "missing.ics"), nil).Refresh(context.Background())
+	assert.Error(t, err)
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		icalURL string
+		path    string
+		ok      bool
+	}{
+		{"/home/me/calendar.ics", "/home/me/calendar.ics", true},
+		{"calendar.ics", "calendar.ics", true},
+		{"file:///home/me/calendar.ics", "/home/me/calendar.ics", true},
+		{"https://example.com/calendar.ics", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.icalURL, func(t *testing.T) {
+			path, ok := localPath(test.icalURL)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.path, path)
+		})
+	}
+}
+
+func TestValidateICalURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/calendar.ics", true},
+		{"http://example.com/calendar.ics", true},
+		{"file:///srv/calendar.ics", true},
+		{"calendars/work.ics", true},
+		{"", false},
+		{"https:///calendar.ics", false},
+		{"webcal://example.com/calendar.ics", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := ValidateICalURL(test.url)
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		a, b   time.Time
+		expect int
+	}{
+		{
+			name:   "same_day",
+			a:      time.Date(2022, time.November, 1, 0, 0, 0, 0, losAngeles),
+			b:      time.Date(2022, time.November, 1, 23, 0, 0, 0, losAngeles),
+			expect: 0,
+		},
+		{
+			name:   "across_dst",
+			a:      time.Date(2022, time.November, 5, 23, 0, 0, 0, losAngeles),
+			b:      time.Date(2022, time.November, 7, 0, 0, 0, 0, losAngeles),
+			expect: 2,
+		},
+		{
+			name:   "backwards",
+			a:      time.Date(2022, time.November, 7, 0, 0, 0, 0, losAngeles),
+			b:      time.Date(2022, time.November, 5, 23, 0, 0, 0, losAngeles),
+			expect: -2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, DaysBetween(test.a, test.b))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"Tue, 01 Nov 2022 00:00:30 GMT", 30 * time.Second},
+		{"Mon, 31 Oct 2022 00:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expect, parseRetryAfter(test.value, now), "value %q", test.value)
+	}
+}
+
 var rruleRe = regexp.MustCompile(`(?m)^RRULE:.*\n`)
 
 func icsRemoveRRules(ics string) string { return rruleRe.ReplaceAllString(ics, "") }
@@ -1,8 +1,10 @@
 package calendar
 
 import (
+	"cmp"
 	"context"
 	"log/slog"
+	"math"
 	"slices"
 	"sync"
 	"time"
@@ -21,6 +23,100 @@ type Notification struct {
 	Event Event
 	// RemindedAt is the time that the notification was sent.
 	RemindedAt time.Time
+	// Kind is the kind of notification.
+	Kind NotificationKind
+	// Action is the action of the reminder that triggered the notification.
+	// It is empty for notifications that are not triggered by a reminder.
+	Action ReminderAction
+}
+
+// NotificationKind is the kind of a notification.
+type NotificationKind string
+
+const (
+	// NotificationReminder is a regular reminder for an upcoming event.
+	NotificationReminder NotificationKind = ""
+	// NotificationUpdated is sent when an event that was already reminded
+	// about has been rescheduled. It is only sent if
+	// NotifierOpts.RemindIfUpdated is true.
+	NotificationUpdated NotificationKind = "updated"
+	// NotificationCancelled is sent when an event that was already reminded
+	// about has been cancelled. It is only sent if NotifierOpts.RemindIfUpdated
+	// is true and EventsOpts.ExcludeCancelled is false.
+	NotificationCancelled NotificationKind = "cancelled"
+	// NotificationAnnounced is sent once when an upcoming event is first seen
+	// by the notifier, regardless of its reminders. It is only sent if
+	// NotifierOpts.AnnounceNewEvents is true.
+	NotificationAnnounced NotificationKind = "announced"
+)
+
+// eventKey identifies an event within a calendar. Occurrences of a recurring
+// event are told apart by their original start time, which an occurrence that
+// is rescheduled on its own keeps as its RECURRENCE-ID.
+type eventKey struct {
+	Calendar      any
+	UID           string
+	OriginalStart int64
+}
+
+// occurrenceKey identifies a single occurrence of an event within a calendar.
+type occurrenceKey struct {
+	Calendar any
+	UID      string
+	Summary  string
+	StartsAt int64
+}
+
+func (n Notification) occurrenceKey() occurrenceKey {
+	return occurrenceKey{
+		Calendar: calendarID(n.Calendar),
+		UID:      n.Event.UID,
+		Summary:  n.Event.Summary,
+		StartsAt: n.Event.StartsAt.UnixNano(),
+	}
+}
+
+// deliveryKey identifies a single notification of an event occurrence.
+type deliveryKey struct {
+	occurrenceKey
+	Kind   NotificationKind
+	Action ReminderAction
+}
+
+func (n Notification) deliveryKey() deliveryKey {
+	return deliveryKey{n.occurrenceKey(), n.Kind, n.Action}
+}
+
+func (n Notification) eventKey() (eventKey, bool) {
+	if n.Event.UID == "" {
+		return eventKey{}, false
+	}
+
+	key := eventKey{Calendar: calendarID(n.Calendar), UID: n.Event.UID}
+	switch {
+	case !n.Event.RecurrenceID.IsZero():
+		key.OriginalStart = n.Event.RecurrenceID.Unix()
+	case n.Event.Recurrence != nil:
+		key.OriginalStart = n.Event.StartsAt.Unix()
+	}
+	return key, true
+}
+
+// Identifier is implemented by calendars that have a stable identity. The
+// notifier tracks the events of such calendars by their ID rather than by the
+// calendar itself, so that a calendar can be replaced by an equivalent one,
+// e.g. after reloading the configuration, without its events being seen as
+// new.
+type Identifier interface {
+	CalendarID() string
+}
+
+// calendarID returns the identity of the calendar for tracking its events.
+func calendarID(cal Calendar) any {
+	if id, ok := cal.(Identifier); ok {
+		return id.CalendarID()
+	}
+	return cal
 }
 
 // IsZero returns true if the notification is zero.
@@ -30,18 +126,27 @@ func (n Notification) IsZero() bool {
 
 // NotifierState is the state of a Notifier.
 type NotifierState struct {
-	Calendars map[Calendar]struct{}
+	// Calendars maps calendars to their location. A nil location means
+	// NotifierOpts.Location.
+	Calendars map[Calendar]*time.Location
 }
 
 func newNotifierState() NotifierState {
 	return NotifierState{
-		Calendars: make(map[Calendar]struct{}),
+		Calendars: make(map[Calendar]*time.Location),
 	}
 }
 
 // AddCalendar adds a calendar to the notifier's state.
 func (n *NotifierState) AddCalendar(cal Calendar) {
-	n.Calendars[cal] = struct{}{}
+	n.Calendars[cal] = nil
+}
+
+// AddCalendarIn adds a calendar to the notifier's state. The calendar's days
+// start at midnight in the given location rather than in
+// NotifierOpts.Location, and its floating times are in that location.
+func (n *NotifierState) AddCalendarIn(cal Calendar, loc *time.Location) {
+	n.Calendars[cal] = loc
 }
 
 // RemoveCalendar removes a calendar from the notifier's state.
@@ -59,6 +164,149 @@ type NotifierOpts struct {
 	// This is useful as a recovery mechanism if the notifier was down for
 	// a while.
 	SkipPastNotifications bool
+	// PastGrace, if non-zero, is how long after their time past-due
+	// reminders of upcoming events are still sent. Reminders that were due
+	// earlier are skipped. If zero, all past-due reminders are sent unless
+	// SkipPastNotifications is true.
+	PastGrace time.Duration
+	// ReplaySince, if non-zero, is the time up to which reminders were
+	// already processed, e.g. by a previous run of the notifier. Past-due
+	// reminders after it are still sent, even if SkipPastNotifications is
+	// true, while reminders up to it are always skipped. It is advanced as
+	// notifications are delivered.
+	ReplaySince time.Time
+	// CollapseOnFirstSighting, if true, collapses the past-due reminders of
+	// upcoming events that the notifier sees for the first time into a single
+	// notification that is sent immediately. The other past-due reminders are
+	// skipped with SkipReasonCollapsed. This is independent of
+	// SkipPastNotifications.
+	CollapseOnFirstSighting bool
+	// RemindIfUpdated, if true, will send a NotificationUpdated notification
+	// when an event that was already reminded about is rescheduled. Events
+	// are matched by their UID, and are only considered rescheduled if their
+	// sequence number has increased.
+	RemindIfUpdated bool
+	// LookaheadWindow is how far ahead of the start of the day to look for
+	// reminders. It defaults to a day.
+	LookaheadWindow time.Duration
+	// BatchWindow, if non-zero, groups notifications that are to be sent
+	// within this duration after the next notification. The whole group is
+	// delivered together when the first notification is due, so that only one
+	// timer wakeup is needed.
+	BatchWindow time.Duration
+	// AnnounceNewEvents, if true, sends a NotificationAnnounced notification
+	// for every upcoming event within AnnounceWindow that is added to a
+	// calendar after the calendar was first loaded. New events are told apart
+	// by their UID and RECURRENCE-ID, so it only works for calendars that
+	// implement EventLister, and never for events without a UID.
+	AnnounceNewEvents bool
+	// AnnounceWindow is how far ahead to look for new events to announce. It
+	// defaults to a week.
+	AnnounceWindow time.Duration
+	// Retention is how long events are remembered after they end for
+	// RemindIfUpdated and CollapseOnFirstSighting. Longer retention allows
+	// detecting changes to events that have already ended, at the cost of
+	// memory.
+	Retention time.Duration
+	// DeliverTimeout, if non-zero, is how long to wait for the destination
+	// channel to receive a due notification. If it isn't ready in time, the
+	// notification is dropped with SkipReasonDeliverTimeout and the notifier
+	// moves on. If zero, the notifier waits indefinitely.
+	DeliverTimeout time.Duration
+	// Order, if not nil, is used to order notifications that are to be sent
+	// at the same time. If nil, OrderByStartTime is used.
+	Order NotificationOrder
+
+	// Clock, if not nil, is used to tell the time and to wait for
+	// notifications. It defaults to the real clock.
+	Clock clocker.Clock
+
+	// OnQueue, if not nil, is called whenever a notification is queued to be
+	// fired next.
+	OnQueue func(Notification)
+	// OnFire, if not nil, is called whenever a notification is delivered to
+	// the destination channel.
+	OnFire func(Notification)
+	// OnSkip, if not nil, is called whenever a notification is dropped
+	// without being delivered. The reason describes why.
+	OnSkip func(Notification, SkipReason)
+}
+
+// NotificationOrder compares two notifications. It is used to break ties
+// between notifications that are sent at the same time.
+type NotificationOrder func(a, b Notification) int
+
+// OrderByStartTime orders notifications by their event's start time.
+func OrderByStartTime(a, b Notification) int {
+	return CompareEvent(a.Event, b.Event)
+}
+
+// OrderByPriority orders notifications by their event's priority, with the
+// highest priority first. Events without a priority are ordered last. Ties are
+// broken by start time.
+func OrderByPriority(a, b Notification) int {
+	if c := cmp.Compare(priorityRank(a.Event), priorityRank(b.Event)); c != 0 {
+		return c
+	}
+	return OrderByStartTime(a, b)
+}
+
+func priorityRank(e Event) int {
+	if e.Priority <= 0 {
+		return math.MaxInt
+	}
+	return e.Priority
+}
+
+// OrderByCalendar returns a NotificationOrder that orders notifications by the
+// position of their calendar in the given list. Calendars not in the list are
+// ordered last. Ties are broken by start time.
+func OrderByCalendar(calendars []Calendar) NotificationOrder {
+	rank := func(c Calendar) int {
+		if i := slices.Index(calendars, c); i != -1 {
+			return i
+		}
+		return len(calendars)
+	}
+	return func(a, b Notification) int {
+		if c := cmp.Compare(rank(a.Calendar), rank(b.Calendar)); c != 0 {
+			return c
+		}
+		return OrderByStartTime(a, b)
+	}
+}
+
+// SkipReason describes why a notification was skipped.
+type SkipReason string
+
+const (
+	// SkipReasonPast is used when the notification's time has already
+	// passed.
+	SkipReasonPast SkipReason = "past"
+	// SkipReasonCollapsed is used when the notification was collapsed into
+	// another one because of NotifierOpts.CollapseOnFirstSighting.
+	SkipReasonCollapsed SkipReason = "collapsed"
+	// SkipReasonDeliverTimeout is used when the destination channel wasn't
+	// ready to receive the notification within NotifierOpts.DeliverTimeout.
+	SkipReasonDeliverTimeout SkipReason = "deliver_timeout"
+)
+
+func (o NotifierOpts) onQueue(n Notification) {
+	if o.OnQueue != nil {
+		o.OnQueue(n)
+	}
+}
+
+func (o NotifierOpts) onFire(n Notification) {
+	if o.OnFire != nil {
+		o.OnFire(n)
+	}
+}
+
+func (o NotifierOpts) onSkip(n Notification, reason SkipReason) {
+	if o.OnSkip != nil {
+		o.OnSkip(n, reason)
+	}
 }
 
 // Notifier contains controls for a Monitor.
@@ -80,6 +328,22 @@ func NewNotifier(opts NotifierOpts) *Notifier {
 		opts.Location = time.Local
 	}
 
+	if opts.Order == nil {
+		opts.Order = OrderByStartTime
+	}
+
+	if opts.LookaheadWindow == 0 {
+		opts.LookaheadWindow = Day
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clocker.Real
+	}
+
+	if opts.AnnounceWindow == 0 {
+		opts.AnnounceWindow = 7 * Day
+	}
+
 	return &Notifier{
 		opts:   opts,
 		done:   make(chan struct{}),
@@ -119,8 +383,13 @@ func (n *Notifier) notifyingEvents(start, end time.Time) []notifyingEvent {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	for cal := range n.state.Calendars {
-		events := cal.EventsBetween(start, end, n.opts.EventsOpts)
+	for cal, loc := range n.state.Calendars {
+		calStart, calEnd := start, end
+		if loc != nil {
+			calStart, calEnd = localWindow(start, end, loc)
+		}
+
+		events := cal.EventsBetween(calStart, calEnd, n.opts.EventsOpts)
 
 		for _, ev := range events {
 			if len(ev.Reminders) == 0 {
@@ -155,22 +424,229 @@ func (n *Notifier) notifications(start, end time.Time) []Notification {
 				Calendar:   ev.Calendar,
 				Event:      ev.Event,
 				RemindedAt: reminder.RemindAt,
+				Action:     reminder.Action,
 			})
 		}
 	}
 
-	slices.SortFunc(notifications, func(a, b Notification) int {
-		return CompareTime(a.RemindedAt, b.RemindedAt)
+	slices.SortFunc(notifications, n.compareNotifications)
+	return notifications
+}
+
+// UpcomingEvents returns the notifications of the events of all calendars that
+// start, or have a reminder, between start and end. Every reminder of these
+// events is included, sorted like the notifications that Notify delivers.
+// Cancelled events are left out, since they are never reminded about. Nothing
+// is delivered or skipped, so it is safe to call while Notify is running,
+// e.g. to list the events of the week.
+func (n *Notifier) UpcomingEvents(start, end time.Time) []Notification {
+	return slices.DeleteFunc(n.notifications(start, end), func(n Notification) bool {
+		return n.Event.Status == EventCancelled
 	})
+}
 
-	return notifications
+func (n *Notifier) compareNotifications(a, b Notification) int {
+	if c := CompareTime(a.RemindedAt, b.RemindedAt); c != 0 {
+		return c
+	}
+	return n.opts.Order(a, b)
+}
+
+// expired returns true if an event that ends at endsAt should be forgotten
+// given the current time.
+func (n *Notifier) expired(endsAt, now time.Time) bool {
+	return endsAt.Add(n.opts.Retention).Before(now)
+}
+
+// collapseFirstSighting collapses the past-due reminders of upcoming events
+// that are not in seen into a single notification sent at now. All events in
+// the given list are then marked as seen, and events that have already ended
+// are pruned from seen. The returned list must be sorted again.
+func (n *Notifier) collapseFirstSighting(seen map[occurrenceKey]time.Time, notifications []Notification, now time.Time) []Notification {
+	// latest maps newly seen occurrences to the index of their latest
+	// past-due notification. The list is sorted, so the last one wins.
+	latest := make(map[occurrenceKey]int)
+	for i, notification := range notifications {
+		key := notification.occurrenceKey()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		if notification.RemindedAt.Before(now) && notification.Event.StartsAt.After(now) {
+			latest[key] = i
+		}
+	}
+
+	collapsed := notifications[:0]
+	for i, notification := range notifications {
+		key := notification.occurrenceKey()
+		seen[key] = notification.Event.EndsAt
+
+		j, ok := latest[key]
+		switch {
+		case !ok || !notification.RemindedAt.Before(now):
+			collapsed = append(collapsed, notification)
+		case i == j:
+			notification.RemindedAt = now
+			collapsed = append(collapsed, notification)
+		default:
+			n.opts.onSkip(notification, SkipReasonCollapsed)
+		}
+	}
+
+	for key, endsAt := range seen {
+		if n.expired(endsAt, now) {
+			delete(seen, key)
+		}
+	}
+
+	return collapsed
+}
+
+// announcedNotifications returns notifications for the upcoming events within
+// the announce window that are new since the last call. An event is new if
+// its ID was not among the calendar's event IDs in the last call, so only
+// calendars that implement EventLister are announced about. known maps the
+// ID of each calendar to its last event IDs. The first time a calendar is
+// loaded only fills in known, so that its existing events aren't announced.
+func (n *Notifier) announcedNotifications(known map[any]map[EventID]struct{}, now time.Time) []Notification {
+	var announced []Notification
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for cal, loc := range n.state.Calendars {
+		lister, ok := cal.(EventLister)
+		if !ok {
+			continue
+		}
+
+		start := now
+		if loc != nil {
+			start = now.In(loc)
+		}
+
+		ids, ok := lister.EventIDs(start.Location())
+		if !ok {
+			// Not loaded yet, e.g. because fetching it failed. Its events
+			// aren't new once it is.
+			continue
+		}
+
+		calID := calendarID(cal)
+		prev, seen := known[calID]
+
+		current := make(map[EventID]struct{}, len(ids))
+		newIDs := make(map[EventID]struct{})
+		for _, id := range ids {
+			current[id] = struct{}{}
+			if _, ok := prev[id]; !ok {
+				newIDs[id] = struct{}{}
+			}
+		}
+		known[calID] = current
+
+		if !seen || len(newIDs) == 0 {
+			continue
+		}
+
+		// Events are sorted by start time, so only the first upcoming
+		// occurrence of a new recurring event is announced.
+		for _, ev := range cal.EventsBetween(start, start.Add(n.opts.AnnounceWindow), n.opts.EventsOpts) {
+			id := ev.ID()
+			if _, ok := newIDs[id]; !ok {
+				continue
+			}
+			if ev.Status == EventCancelled || !ev.StartsAt.After(now) {
+				continue
+			}
+			delete(newIDs, id)
+
+			announced = append(announced, Notification{
+				Calendar:   cal,
+				Event:      ev,
+				RemindedAt: now,
+				Kind:       NotificationAnnounced,
+			})
+		}
+	}
+
+	return announced
+}
+
+// updatedNotifications returns notifications for events in the given list that
+// were already delivered but have since been rescheduled. The delivered map is
+// updated accordingly, and events that have already ended are pruned from it.
+func (n *Notifier) updatedNotifications(delivered map[eventKey]Event, notifications []Notification, now time.Time) []Notification {
+	var updated []Notification
+
+	for _, notification := range notifications {
+		key, ok := notification.eventKey()
+		if !ok {
+			continue
+		}
+
+		old, ok := delivered[key]
+		if !ok || notification.Event.Sequence <= old.Sequence {
+			continue
+		}
+
+		delivered[key] = notification.Event
+
+		var kind NotificationKind
+		switch {
+		case notification.Event.Status == EventCancelled:
+			if old.Status == EventCancelled {
+				continue
+			}
+			kind = NotificationCancelled
+		case old.StartsAt.Equal(notification.Event.StartsAt) && old.EndsAt.Equal(notification.Event.EndsAt):
+			continue
+		default:
+			kind = NotificationUpdated
+		}
+
+		updated = append(updated, Notification{
+			Calendar:   notification.Calendar,
+			Event:      notification.Event,
+			RemindedAt: now,
+			Kind:       kind,
+		})
+	}
+
+	for key, event := range delivered {
+		if n.expired(event.EndsAt, now) {
+			delete(delivered, key)
+		}
+	}
+
+	return updated
 }
 
 // shouldSkip returns true if the notification should be skipped given the
-// current time.
-func (n *Notifier) shouldSkip(notification Notification, now time.Time) bool {
+// current time and the time up to which reminders were already processed.
+// atSince holds the notifications due at since that were delivered; if it is
+// nil, all of them were.
+func (n *Notifier) shouldSkip(notification Notification, now, since time.Time, atSince map[deliveryKey]struct{}) bool {
+	if !since.IsZero() {
+		if notification.RemindedAt.Before(since) {
+			return true
+		}
+		if notification.RemindedAt.Equal(since) {
+			if atSince == nil {
+				return true
+			}
+			if _, ok := atSince[notification.deliveryKey()]; ok {
+				return true
+			}
+		}
+	}
+
+	if n.opts.PastGrace > 0 && notification.RemindedAt.Before(now.Add(-n.opts.PastGrace)) {
+		return true
+	}
+
 	startsAt := notification.Event.StartsAt
-	if n.opts.SkipPastNotifications {
+	if n.opts.SkipPastNotifications && since.IsZero() {
 		// If we're skipping past notifications, then we should use the
 		// notification's reminded at time instead of the event's start time.
 		startsAt = notification.RemindedAt
@@ -178,8 +654,9 @@ func (n *Notifier) shouldSkip(notification Notification, now time.Time) bool {
 	return startsAt.Before(now)
 }
 
-// Notify starts the notifier. It returns when the context is done. It may drop
-// notifications if the channel is not ready to receive them in time.
+// Notify starts the notifier. It returns when the context is done. It drops
+// notifications if the channel is not ready to receive them within
+// NotifierOpts.DeliverTimeout.
 func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 	select {
 	case <-n.done:
@@ -188,7 +665,9 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 		defer close(n.done)
 	}
 
-	dayTicker := clocker.NewTicker(1 * Day)
+	// Anchor the day ticker to the start of the day in the notifier's
+	// location, so that it ticks at local midnight rather than UTC midnight.
+	dayTicker := n.opts.Clock.NewTicker(ctx, 1*Day, dayStart(n.opts.Clock.Now().In(n.opts.Location)))
 	defer dayTicker.Stop()
 
 	notificationTimer := (<-chan time.Time)(nil)
@@ -196,20 +675,81 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 	defer func() { notificationTimerStop() }()
 
 	var notifications []Notification
+	// batch is the number of notifications at the front of the queue that
+	// will be delivered when the timer fires.
+	var batch int
+	// delivered keeps track of events that were already reminded about. It is
+	// only used if RemindIfUpdated is true.
+	delivered := make(map[eventKey]Event)
+	// seen keeps track of event occurrences that were already seen, mapped to
+	// their end time. It is only used if CollapseOnFirstSighting is true.
+	seen := make(map[occurrenceKey]time.Time)
+	// known maps calendars to the IDs of their events as of the last
+	// refresh. It is only used if AnnounceNewEvents is true.
+	known := make(map[any]map[EventID]struct{})
+	// since is the time up to which reminders were already delivered. It is
+	// only used if ReplaySince is set. Multiple reminders may be due at the
+	// same time, so atSince tracks which of those due at since were
+	// delivered. It is nil at first, since everything due at ReplaySince was
+	// processed by the previous run.
+	since := n.opts.ReplaySince
+	var atSince map[deliveryKey]struct{}
 
 	var refreshNotifications func(time.Time)
 	var queueNext func(time.Time)
 
 	refreshNotifications = func(now time.Time) {
-		dayStart := dayStart(now)
-		dayEnd := dayStart.Add(Day)
+		// The whole queue is rebuilt on every refresh, so events that are
+		// seen by multiple refreshes are never queued twice.
+		start := dayStart(now)
+		end := start.Add(n.opts.LookaheadWindow)
+
+		// Look back far enough to replay the reminders missed since the
+		// last delivered one.
+		if !since.IsZero() && since.Before(start) {
+			start = since
+		}
 
 		slog.DebugContext(ctx,
 			"refreshing notifications",
-			"day_start", dayStart,
-			"day_end", dayEnd)
+			"start", start,
+			"end", end)
+
+		notifications = n.notifications(start, end)
+		if n.opts.CollapseOnFirstSighting {
+			notifications = n.collapseFirstSighting(seen, notifications, now)
+			slices.SortFunc(notifications, n.compareNotifications)
+		}
+		if n.opts.AnnounceNewEvents {
+			announced := n.announcedNotifications(known, now)
+
+			if len(announced) > 0 {
+				notifications = append(notifications, announced...)
+				slices.SortFunc(notifications, n.compareNotifications)
+			}
+		}
+
+		if n.opts.RemindIfUpdated {
+			updated := n.updatedNotifications(delivered, notifications, now)
+
+			// Cancelled events are only kept around to detect cancellations.
+			// They should never be reminded about.
+			notifications = slices.DeleteFunc(notifications, func(n Notification) bool {
+				return n.Event.Status == EventCancelled
+			})
+
+			if len(updated) > 0 {
+				notifications = append(notifications, updated...)
+				slices.SortFunc(notifications, n.compareNotifications)
+			}
+		}
+
+		slog.DebugContext(ctx,
+			"notifications refreshed",
+			"queued", len(notifications),
+			"delivered_events", len(delivered),
+			"seen_events", len(seen))
 
-		notifications = n.notifications(dayStart, dayEnd)
 		queueNext(now)
 	}
 
@@ -219,7 +759,8 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 
 		// Purge all late events. Don't actually skip past notifications for
 		// future events, since we may have missed some notifications.
-		for len(notifications) > 0 && n.shouldSkip(notifications[0], now) {
+		for len(notifications) > 0 && n.shouldSkip(notifications[0], now, since, atSince) {
+			n.opts.onSkip(notifications[0], SkipReasonPast)
 			notifications = notifications[1:]
 		}
 
@@ -230,13 +771,24 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 		}
 
 		next := notifications[0]
+
+		batch = 1
+		if n.opts.BatchWindow > 0 {
+			for batch < len(notifications) &&
+				notifications[batch].RemindedAt.Sub(next.RemindedAt) <= n.opts.BatchWindow {
+				batch++
+			}
+		}
+
 		slog.DebugContext(ctx,
 			"next notification queued",
 			"next_reminder", next.RemindedAt,
-			"next_event", next.Event.Summary)
+			"next_event", next.Event.Summary,
+			"batch_size", batch)
+		n.opts.onQueue(next)
 
-		t := time.NewTimer(next.RemindedAt.Sub(now))
-		notificationTimer = t.C
+		t := n.opts.Clock.NewTimer(next.RemindedAt.Sub(now))
+		notificationTimer = t.C()
 		notificationTimerStop = func() { t.Stop() }
 	}
 
@@ -254,7 +806,7 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 		case <-n.update:
 			slog.DebugContext(ctx,
 				"calendar update received, refreshing notifications")
-			refreshNotifications(time.Now().In(n.opts.Location))
+			refreshNotifications(n.opts.Clock.Now().In(n.opts.Location))
 
 		case now := <-notificationTimer:
 			if len(notifications) == 0 {
@@ -262,22 +814,53 @@ func (n *Notifier) Notify(ctx context.Context, dst chan<- Notification) error {
 			}
 
 			// Next tick is used to wake up the loop when the next event is
-			// about to happen.
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			// case <-nextTickTimeout.C:
-			// 	// Notification is no longer relevant.
-			// 	slog.WarnContext(ctx,
-			// 		"dropped notification",
-			// 		"notification", nextNotification)
-			case dst <- notifications[0]:
+			// about to happen. Deliver the whole batch that it was armed for.
+			for ; batch > 0; batch-- {
+				var deliverTimeout <-chan time.Time
+				deliverTimeoutStop := func() bool { return false }
+				if n.opts.DeliverTimeout > 0 {
+					t := n.opts.Clock.NewTimer(n.opts.DeliverTimeout)
+					deliverTimeout = t.C()
+					deliverTimeoutStop = t.Stop
+				}
+
+				select {
+				case <-ctx.Done():
+					deliverTimeoutStop()
+					return ctx.Err()
+				case <-deliverTimeout:
+					slog.WarnContext(ctx,
+						"dropped notification, receiver not ready",
+						"event", notifications[0].Event.Summary,
+						"reminded_at", notifications[0].RemindedAt,
+						"deliver_timeout", n.opts.DeliverTimeout)
+					n.opts.onSkip(notifications[0], SkipReasonDeliverTimeout)
+				case dst <- notifications[0]:
+					deliverTimeoutStop()
+					n.opts.onFire(notifications[0])
+					if !since.IsZero() {
+						if remindedAt := notifications[0].RemindedAt; remindedAt.After(since) {
+							since = remindedAt
+							atSince = make(map[deliveryKey]struct{})
+						}
+						if atSince != nil && notifications[0].RemindedAt.Equal(since) {
+							atSince[notifications[0].deliveryKey()] = struct{}{}
+						}
+					}
+					if n.opts.RemindIfUpdated {
+						if key, ok := notifications[0].eventKey(); ok {
+							delivered[key] = notifications[0].Event
+						}
+					}
+				}
+
 				// Explicitly remove the notification from the queue.
-				// QueueNext won't do this for us until the event itself has
-				// started, in case we missed some notifications.
+				// QueueNext won't do this for us until the event itself
+				// has started, in case we missed some notifications.
 				notifications = notifications[1:]
-				queueNext(now.In(n.opts.Location))
 			}
+
+			queueNext(now.In(n.opts.Location))
 		}
 	}
 }
@@ -290,6 +873,18 @@ func drainTimer(t *time.Timer) {
 	}
 }
 
+// localWindow moves the start of the given window to the start of its day in
+// loc, keeping its length. The returned window always covers the given one, so
+// that no reminders are missed until the next refresh.
+func localWindow(start, end time.Time, loc *time.Location) (time.Time, time.Time) {
+	localStart := dayStart(start.In(loc))
+	localEnd := localStart.Add(end.Sub(start))
+	if localEnd.Before(end) {
+		localEnd = end.In(loc)
+	}
+	return localStart, localEnd
+}
+
 // dayStart returns the start of the day for the given time. It uses the
 // timezone configured in the given timestamp.
 func dayStart(t time.Time) time.Time {
@@ -3,9 +3,12 @@ package calendar
 import (
 	"context"
 	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"libdb.so/discord-ical-reminder/clocker"
 )
 
 func TestNotifier(t *testing.T) {
@@ -20,7 +23,7 @@ func TestNotifier(t *testing.T) {
 
 	notifications := make(chan Notification)
 	go func() {
-		if err := notifier.Notify(ctx, notifications); err != nil {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
 			t.Error(err)
 		}
 	}()
@@ -77,30 +80,1367 @@ func TestNotifier(t *testing.T) {
 	}
 }
 
-type mockCalendar struct {
-	mu     sync.Mutex
-	events []Event
+func TestNotifier_fakeClock(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 9, 0, 0, 0, time.UTC)
+	clock := clocker.NewFakeClock(now)
+
+	notifier := NewNotifier(NotifierOpts{
+		Location: time.UTC,
+		Clock:    clock,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				Summary:  "A",
+				StartsAt: now.Add(2 * time.Hour),
+				EndsAt:   now.Add(3 * time.Hour),
+				Reminders: []Reminder{
+					{RemindAt: now.Add(1 * time.Hour)},
+					{RemindAt: now.Add(90 * time.Minute)},
+				},
+			},
+			{
+				Summary:   "B",
+				StartsAt:  now.Add(3 * time.Hour),
+				EndsAt:    now.Add(4 * time.Hour),
+				Reminders: []Reminder{{RemindAt: now.Add(30 * time.Minute)}},
+			},
+		}))
+	})
+
+	expect := []struct {
+		summary    string
+		remindedAt time.Time
+	}{
+		{"B", now.Add(30 * time.Minute)},
+		{"A", now.Add(1 * time.Hour)},
+		{"A", now.Add(90 * time.Minute)},
+	}
+
+	for i, expect := range expect {
+		// Wait for the day ticker and the notification timer.
+		clock.WaitForTimers(2)
+		clock.Advance(expect.remindedAt.Sub(clock.Now()))
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for notification %d", i)
+		case n := <-notifications:
+			if n.Event.Summary != expect.summary || !n.RemindedAt.Equal(expect.remindedAt) {
+				t.Errorf(
+					"notification %d: expected %s at %v, got %s at %v",
+					i, expect.summary, expect.remindedAt, n.Event.Summary, n.RemindedAt)
+			}
+		}
+	}
+
+	cancel()
+	<-notifier.done
 }
 
-func newMockCalendar(events []Event) *mockCalendar {
-	return &mockCalendar{events: events}
+func TestNotifier_hooks(t *testing.T) {
+	var mu sync.Mutex
+	var queued, fired, skipped int
+
+	notifier := NewNotifier(NotifierOpts{
+		SkipPastNotifications: true,
+		OnQueue: func(Notification) {
+			mu.Lock()
+			queued++
+			mu.Unlock()
+		},
+		OnFire: func(Notification) {
+			mu.Lock()
+			fired++
+			mu.Unlock()
+		},
+		OnSkip: func(_ Notification, reason SkipReason) {
+			if reason != SkipReasonPast {
+				t.Errorf("unexpected skip reason %q", reason)
+			}
+			mu.Lock()
+			skipped++
+			mu.Unlock()
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	notifier.Update(func(state *NotifierState) {
+		now := time.Now().Add(150 * time.Millisecond)
+
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				StartsAt: now.Add(300 * time.Millisecond),
+				EndsAt:   now.Add(450 * time.Millisecond),
+				Reminders: []Reminder{
+					{RemindAt: now.Add(-500 * time.Millisecond)},
+					{RemindAt: now.Add(150 * time.Millisecond)},
+				},
+			},
+		}))
+	})
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	case <-notifications:
+	}
+
+	cancel()
+	<-notifier.done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if queued != 1 {
+		t.Errorf("expected 1 queued notification, got %d", queued)
+	}
+	if fired != 1 {
+		t.Errorf("expected 1 fired notification, got %d", fired)
+	}
+	if skipped != 1 {
+		t.Errorf("expected 1 skipped notification, got %d", skipped)
+	}
 }
 
-func (c *mockCalendar) addEvents(events []Event) {
-	c.mu.Lock()
-	c.events = append(c.events, events...)
-	c.mu.Unlock()
+func TestNotifier_deliverTimeout(t *testing.T) {
+	skipped := make(chan Notification, 1)
+
+	notifier := NewNotifier(NotifierOpts{
+		DeliverTimeout: 50 * time.Millisecond,
+		OnSkip: func(n Notification, reason SkipReason) {
+			if reason != SkipReasonDeliverTimeout {
+				t.Errorf("unexpected skip reason %q", reason)
+			}
+			skipped <- n
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	notifier.Update(func(state *NotifierState) {
+		now := time.Now()
+
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				Summary:   "stalled",
+				StartsAt:  now.Add(time.Second),
+				EndsAt:    now.Add(2 * time.Second),
+				Reminders: []Reminder{{RemindAt: now.Add(100 * time.Millisecond)}},
+			},
+			{
+				Summary:   "received",
+				StartsAt:  now.Add(time.Second),
+				EndsAt:    now.Add(2 * time.Second),
+				Reminders: []Reminder{{RemindAt: now.Add(300 * time.Millisecond)}},
+			},
+		}))
+	})
+
+	// Stall the receiver until the first notification is dropped.
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification to be dropped")
+	case n := <-skipped:
+		if n.Event.Summary != "stalled" {
+			t.Errorf("unexpected dropped notification %q", n.Event.Summary)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	case n := <-notifications:
+		if n.Event.Summary != "received" {
+			t.Errorf("unexpected notification %q", n.Event.Summary)
+		}
+	}
+
+	cancel()
+	<-notifier.done
 }
 
-func (c *mockCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Event {
-	var events []Event
-	for _, e := range c.events {
-		e.Reminders = append(e.Reminders, opts.EventReminders(e)...)
-		if e.Within(start, end, opts.IncludeReminders) {
-			events = append(events, e)
+func TestNotifier_batch(t *testing.T) {
+	var mu sync.Mutex
+	var queued []string
+
+	notifier := NewNotifier(NotifierOpts{
+		BatchWindow: 150 * time.Millisecond,
+		OnQueue: func(n Notification) {
+			mu.Lock()
+			queued = append(queued, n.Event.Summary)
+			mu.Unlock()
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	now := time.Now()
+	event := func(summary string, remindIn time.Duration) Event {
+		return Event{
+			Summary:   summary,
+			StartsAt:  now.Add(10 * time.Minute),
+			EndsAt:    now.Add(20 * time.Minute),
+			Reminders: []Reminder{{RemindAt: now.Add(remindIn)}},
 		}
 	}
 
-	slices.SortFunc(events, CompareEvent)
-	return events
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			event("first", 200*time.Millisecond),
+			event("second", 300*time.Millisecond),
+			event("third", 700*time.Millisecond),
+		}))
+	})
+
+	expect := []string{"first", "second", "third"}
+	var received []time.Time
+
+	for i, summary := range expect {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for notification %d", i)
+		case notification := <-notifications:
+			if notification.Event.Summary != summary {
+				t.Errorf("notification %d: expected %q, got %q", i, summary, notification.Event.Summary)
+			}
+			received = append(received, time.Now())
+		}
+	}
+
+	cancel()
+	<-notifier.done
+
+	// The second notification should be delivered together with the first,
+	// before it is actually due.
+	if received[1].After(now.Add(280 * time.Millisecond)) {
+		t.Errorf("second notification was not batched with the first")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !slices.Equal(queued, []string{"first", "third"}) {
+		t.Errorf("expected batches to start with [first third], got %q", queued)
+	}
+}
+
+func TestNotifier_collapseOnFirstSighting(t *testing.T) {
+	var mu sync.Mutex
+	var collapsed int
+
+	notifier := NewNotifier(NotifierOpts{
+		SkipPastNotifications:   true,
+		CollapseOnFirstSighting: true,
+		OnSkip: func(_ Notification, reason SkipReason) {
+			if reason == SkipReasonCollapsed {
+				mu.Lock()
+				collapsed++
+				mu.Unlock()
+			}
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	now := time.Now()
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				UID:      "meeting",
+				StartsAt: now.Add(10 * time.Minute),
+				EndsAt:   now.Add(20 * time.Minute),
+				Reminders: []Reminder{
+					{RemindAt: now.Add(-30 * time.Minute)},
+					{RemindAt: now.Add(-20 * time.Minute)},
+					{RemindAt: now.Add(-10 * time.Minute)},
+					{RemindAt: now.Add(5 * time.Minute)},
+				},
+			},
+		}))
+	})
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for heads up")
+	case notification := <-notifications:
+		if notification.RemindedAt.Before(now) {
+			t.Errorf("heads up was not sent at the time it was collapsed")
+		}
+	}
+
+	// The event has been seen now, so refreshing should not send another
+	// heads up.
+	notifier.Invalidate()
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification reminded at %v", notification.RemindedAt)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	<-notifier.done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if collapsed != 2 {
+		t.Errorf("expected 2 collapsed notifications, got %d", collapsed)
+	}
+}
+
+func TestNotifier_order(t *testing.T) {
+	now := time.Now()
+	remindAt := now.Add(1 * time.Hour)
+
+	cal1 := newMockCalendar([]Event{
+		{
+			Summary:   "late, low priority",
+			StartsAt:  now.Add(3 * time.Hour),
+			EndsAt:    now.Add(4 * time.Hour),
+			Priority:  9,
+			Reminders: []Reminder{{RemindAt: remindAt}},
+		},
+	})
+	cal2 := newMockCalendar([]Event{
+		{
+			Summary:   "early, no priority",
+			StartsAt:  now.Add(2 * time.Hour),
+			EndsAt:    now.Add(3 * time.Hour),
+			Reminders: []Reminder{{RemindAt: remindAt}},
+		},
+		{
+			Summary:   "latest, high priority",
+			StartsAt:  now.Add(5 * time.Hour),
+			EndsAt:    now.Add(6 * time.Hour),
+			Priority:  1,
+			Reminders: []Reminder{{RemindAt: remindAt}},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		order  NotificationOrder
+		expect []string
+	}{
+		{
+			name:  "start_time",
+			order: nil,
+			expect: []string{
+				"early, no priority",
+				"late, low priority",
+				"latest, high priority",
+			},
+		},
+		{
+			name:  "priority",
+			order: OrderByPriority,
+			expect: []string{
+				"latest, high priority",
+				"late, low priority",
+				"early, no priority",
+			},
+		},
+		{
+			name:  "calendar",
+			order: OrderByCalendar([]Calendar{cal1, cal2}),
+			expect: []string{
+				"late, low priority",
+				"early, no priority",
+				"latest, high priority",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier := NewNotifier(NotifierOpts{Order: test.order})
+			notifier.Update(func(state *NotifierState) {
+				state.AddCalendar(cal1)
+				state.AddCalendar(cal2)
+			})
+
+			notifications := notifier.notifications(now, now.Add(1*Day))
+			summaries := make([]string, len(notifications))
+			for i, n := range notifications {
+				summaries[i] = n.Event.Summary
+			}
+
+			if !slices.Equal(summaries, test.expect) {
+				t.Errorf("expected order %q, got %q", test.expect, summaries)
+			}
+		})
+	}
+}
+
+func TestNotifier_remindIfUpdated(t *testing.T) {
+	notifier := NewNotifier(NotifierOpts{
+		RemindIfUpdated: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	now := time.Now()
+	calendar := newMockCalendar([]Event{
+		{
+			UID:       "meeting",
+			StartsAt:  now.Add(10 * time.Minute),
+			EndsAt:    now.Add(20 * time.Minute),
+			Reminders: []Reminder{{RemindAt: now.Add(100 * time.Millisecond)}},
+		},
+	})
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(calendar)
+	})
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for reminder")
+	case notification := <-notifications:
+		if notification.Kind != NotificationReminder {
+			t.Fatalf("expected reminder, got %q", notification.Kind)
+		}
+	}
+
+	// Reschedule the event without bumping the sequence. This should not
+	// trigger an update.
+	calendar.setEvents([]Event{
+		{
+			UID:      "meeting",
+			StartsAt: now.Add(20 * time.Minute),
+			EndsAt:   now.Add(30 * time.Minute),
+			Reminders: []Reminder{
+				{RemindAt: now.Add(15 * time.Minute)},
+			},
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected %q notification", notification.Kind)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Now bump the sequence.
+	calendar.setEvents([]Event{
+		{
+			UID:      "meeting",
+			StartsAt: now.Add(20 * time.Minute),
+			EndsAt:   now.Add(30 * time.Minute),
+			Sequence: 1,
+			Reminders: []Reminder{
+				{RemindAt: now.Add(15 * time.Minute)},
+			},
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for update")
+	case notification := <-notifications:
+		if notification.Kind != NotificationUpdated {
+			t.Fatalf("expected update, got %q", notification.Kind)
+		}
+		if !notification.Event.StartsAt.Equal(now.Add(20 * time.Minute)) {
+			t.Errorf("update has unexpected start time %v", notification.Event.StartsAt)
+		}
+	}
+
+	// Cancel the event. Its reminders should no longer be sent, and a
+	// cancellation should be sent instead.
+	calendar.setEvents([]Event{
+		{
+			UID:      "meeting",
+			StartsAt: now.Add(20 * time.Minute),
+			EndsAt:   now.Add(30 * time.Minute),
+			Sequence: 2,
+			Status:   EventCancelled,
+			Reminders: []Reminder{
+				{RemindAt: now.Add(15 * time.Minute)},
+			},
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for cancellation")
+	case notification := <-notifications:
+		if notification.Kind != NotificationCancelled {
+			t.Fatalf("expected cancellation, got %q", notification.Kind)
+		}
+	}
+}
+
+func TestNotifier_announceNewEvents(t *testing.T) {
+	notifier := NewNotifier(NotifierOpts{
+		AnnounceNewEvents: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	now := time.Now()
+	calendar := newMockCalendar([]Event{
+		{
+			UID:      "existing",
+			Summary:  "existing",
+			StartsAt: now.Add(1 * Day),
+			EndsAt:   now.Add(1*Day + time.Hour),
+		},
+	})
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(calendar)
+	})
+
+	// Existing events should not be announced.
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification for %q", notification.Event.Summary)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	calendar.addEvents([]Event{
+		{
+			UID:      "new",
+			Summary:  "new",
+			StartsAt: now.Add(2 * Day),
+			EndsAt:   now.Add(2*Day + time.Hour),
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for announcement")
+	case notification := <-notifications:
+		if notification.Kind != NotificationAnnounced {
+			t.Errorf("expected announcement, got %q", notification.Kind)
+		}
+		if notification.Event.Summary != "new" {
+			t.Errorf("expected new event to be announced, got %q", notification.Event.Summary)
+		}
+	}
+
+	// Announcements are only sent once.
+	notifier.Invalidate()
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification for %q", notification.Event.Summary)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNotifier_replaceIdentifiedCalendar(t *testing.T) {
+	notifier := NewNotifier(NotifierOpts{
+		AnnounceNewEvents: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	now := time.Now()
+	events := []Event{
+		{
+			UID:      "existing",
+			Summary:  "existing",
+			StartsAt: now.Add(1 * Day),
+			EndsAt:   now.Add(1*Day + time.Hour),
+		},
+	}
+
+	old := &identifiedCalendar{newMockCalendar(events), "work"}
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(old)
+	})
+
+	// Replacing the calendar with one with the same ID should not announce
+	// its events again.
+	notifier.Update(func(state *NotifierState) {
+		state.RemoveCalendar(old)
+		state.AddCalendar(&identifiedCalendar{newMockCalendar(events), "work"})
+	})
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification for %q", notification.Event.Summary)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// A calendar with a different ID is new, though, so events added to it
+	// afterwards are announced, but not the ones it already had.
+	home := &identifiedCalendar{newMockCalendar(events), "home"}
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(home)
+	})
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification for %q", notification.Event.Summary)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	home.addEvents([]Event{
+		{
+			UID:      "new",
+			Summary:  "new",
+			StartsAt: now.Add(2 * Day),
+			EndsAt:   now.Add(2*Day + time.Hour),
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for announcement")
+	case notification := <-notifications:
+		if id := notification.Calendar.(Identifier).CalendarID(); id != "home" {
+			t.Errorf("expected announcement for calendar home, got %q", id)
+		}
+		if notification.Event.Summary != "new" {
+			t.Errorf("expected new event to be announced, got %q", notification.Event.Summary)
+		}
+	}
+}
+
+func TestNotifier_announceAcrossDays(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 9, 0, 0, 0, time.UTC)
+	clock := clocker.NewFakeClock(now)
+
+	notifier := NewNotifier(NotifierOpts{
+		Location:          time.UTC,
+		Clock:             clock,
+		AnnounceNewEvents: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	var events []Event
+	// A weekly event, whose next occurrence enters the announce window
+	// every week.
+	for week := 0; week < 3; week++ {
+		startsAt := now.Add(Day + time.Duration(week)*7*Day)
+		events = append(events, Event{
+			UID:      "weekly",
+			Summary:  "weekly",
+			StartsAt: startsAt,
+			EndsAt:   startsAt.Add(time.Hour),
+		})
+	}
+	// A one-off event that has long existed, and enters the announce window
+	// in a few days.
+	events = append(events, Event{
+		UID:      "later",
+		Summary:  "later",
+		StartsAt: now.Add(10 * Day),
+		EndsAt:   now.Add(10*Day + time.Hour),
+	})
+
+	// The calendar failed to load at first.
+	calendar := newMockCalendar(events)
+	calendar.unloaded = true
+	notifier.Update(func(state *NotifierState) { state.AddCalendar(calendar) })
+
+	expectNone := func() {
+		t.Helper()
+		select {
+		case notification := <-notifications:
+			t.Fatalf("unexpected notification for %q", notification.Event.Summary)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	expectNone()
+
+	calendar.setLoaded()
+	notifier.Invalidate()
+	expectNone()
+
+	for day := 0; day < 5; day++ {
+		// Wait for the day ticker.
+		clock.WaitForTimers(1)
+		clock.Advance(Day)
+		expectNone()
+	}
+
+	calendar.addEvents([]Event{
+		{
+			UID:      "new",
+			Summary:  "new",
+			StartsAt: clock.Now().Add(2 * Day),
+			EndsAt:   clock.Now().Add(2*Day + time.Hour),
+		},
+	})
+	notifier.Invalidate()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for announcement")
+	case notification := <-notifications:
+		if notification.Kind != NotificationAnnounced || notification.Event.Summary != "new" {
+			t.Errorf("expected new event to be announced, got %q for %q",
+				notification.Kind, notification.Event.Summary)
+		}
+	}
+
+	cancel()
+	<-notifier.done
+}
+
+type identifiedCalendar struct {
+	*mockCalendar
+	id string
+}
+
+func (c *identifiedCalendar) CalendarID() string { return c.id }
+
+func TestNotifier_updatedRecurringEvent(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 9, 0, 0, 0, time.UTC)
+	calendar := newMockCalendar(nil)
+	notifier := NewNotifier(NotifierOpts{})
+
+	weekly := &RecurrenceInfo{Frequency: "WEEKLY", Interval: 1}
+	occurrence := func(week, sequence int) Notification {
+		startsAt := now.Add(Day + time.Duration(week)*7*Day)
+		return Notification{
+			Calendar: calendar,
+			Event: Event{
+				UID:        "standup",
+				StartsAt:   startsAt,
+				EndsAt:     startsAt.Add(15 * time.Minute),
+				Sequence:   sequence,
+				Recurrence: weekly,
+			},
+		}
+	}
+
+	delivered := make(map[eventKey]Event)
+	first := occurrence(0, 0)
+	key, _ := first.eventKey()
+	delivered[key] = first.Event
+
+	// Editing the series bumps the sequence of all occurrences, but they
+	// still happen at the same time.
+	updated := notifier.updatedNotifications(delivered, []Notification{
+		occurrence(0, 1),
+		occurrence(1, 1),
+	}, now)
+	if len(updated) != 0 {
+		t.Errorf("expected no updates, got %d for %q", len(updated), updated[0].Event.StartsAt)
+	}
+
+	// Moving the first occurrence on its own is an update, though.
+	moved := occurrence(0, 2)
+	moved.Event.RecurrenceID = moved.Event.StartsAt
+	moved.Event.StartsAt = moved.Event.StartsAt.Add(time.Hour)
+	moved.Event.EndsAt = moved.Event.EndsAt.Add(time.Hour)
+	moved.Event.Recurrence = nil
+
+	updated = notifier.updatedNotifications(delivered, []Notification{moved}, now)
+	if len(updated) != 1 || updated[0].Kind != NotificationUpdated {
+		t.Fatalf("expected an update, got %v", updated)
+	}
+	if !updated[0].Event.StartsAt.Equal(moved.Event.StartsAt) {
+		t.Errorf("update has unexpected start time %v", updated[0].Event.StartsAt)
+	}
+}
+
+func TestNotifier_retention(t *testing.T) {
+	now := time.Now()
+	calendar := newMockCalendar(nil)
+
+	delivered := func() map[eventKey]Event {
+		return map[eventKey]Event{
+			{Calendar: calendar, UID: "recent"}: {UID: "recent", EndsAt: now.Add(-1 * time.Hour)},
+			{Calendar: calendar, UID: "old"}:    {UID: "old", EndsAt: now.Add(-3 * Day)},
+		}
+	}
+
+	t.Run("none", func(t *testing.T) {
+		notifier := NewNotifier(NotifierOpts{})
+		d := delivered()
+		notifier.updatedNotifications(d, nil, now)
+		if len(d) != 0 {
+			t.Errorf("expected all ended events to be forgotten, got %d", len(d))
+		}
+	})
+
+	t.Run("one_day", func(t *testing.T) {
+		notifier := NewNotifier(NotifierOpts{Retention: 1 * Day})
+		d := delivered()
+		notifier.updatedNotifications(d, nil, now)
+		if _, ok := d[eventKey{Calendar: calendar, UID: "recent"}]; !ok || len(d) != 1 {
+			t.Errorf("expected only the recent event to be kept, got %v", d)
+		}
+	})
+}
+
+func TestNotifier_lookaheadWindow(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 9, 0, 0, 0, time.UTC)
+	clock := clocker.NewFakeClock(now)
+
+	queued := make(chan Notification, 1)
+	notifier := NewNotifier(NotifierOpts{
+		LookaheadWindow: 3 * Day,
+		Location:        time.UTC,
+		Clock:           clock,
+		OnQueue:         func(n Notification) { queued <- n },
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	expectQueued := func(summary string) {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %q to be queued", summary)
+		case n := <-queued:
+			if n.Event.Summary != summary {
+				t.Fatalf("expected %q to be queued, got %q", summary, n.Event.Summary)
+			}
+		}
+	}
+
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				Summary:   "In two days",
+				StartsAt:  now.Add(2 * Day),
+				EndsAt:    now.Add(2*Day + time.Hour),
+				Reminders: []Reminder{{RemindAt: now.Add(1 * time.Hour)}},
+			},
+			{
+				Summary:   "Later",
+				StartsAt:  now.Add(2*Day + 2*time.Hour),
+				EndsAt:    now.Add(2*Day + 3*time.Hour),
+				Reminders: []Reminder{{RemindAt: now.Add(2 * time.Hour)}},
+			},
+		}))
+	})
+	expectQueued("In two days")
+
+	// Refresh a few more times. The event is seen by every refresh, but must
+	// only be queued once.
+	for i := 0; i < 2; i++ {
+		notifier.Invalidate()
+		expectQueued("In two days")
+	}
+
+	clock.WaitForTimers(2)
+	clock.Advance(1 * time.Hour)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	case n := <-notifications:
+		if n.Event.Summary != "In two days" {
+			t.Fatalf("expected the event in two days, got %q", n.Event.Summary)
+		}
+	}
+
+	// A duplicate would be queued next, since it's due right away.
+	expectQueued("Later")
+}
+
+func TestLocalWindow(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Midnight in Los Angeles is 09:00 in Berlin.
+	start := time.Date(2023, time.August, 1, 0, 0, 0, 0, losAngeles)
+	end := start.Add(Day)
+
+	localStart, localEnd := localWindow(start, end, berlin)
+
+	expectStart := time.Date(2023, time.August, 1, 0, 0, 0, 0, berlin)
+	if !localStart.Equal(expectStart) || localStart.Location() != berlin {
+		t.Errorf("expected window to start at %v, got %v", expectStart, localStart)
+	}
+	// Berlin's day ends before Los Angeles' does, so the end must be kept.
+	if !localEnd.Equal(end) {
+		t.Errorf("expected window to end at %v, got %v", end, localEnd)
+	}
+}
+
+const emptyICS = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//discord-ical-reminder//test//EN
+END:VCALENDAR
+`
+
+func TestNotifier_emptyCalendar(t *testing.T) {
+	cal, err := ParseICS(strings.NewReader(strings.ReplaceAll(emptyICS, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal("failed to parse empty calendar:", err)
+	}
+
+	now := time.Date(2023, time.August, 1, 9, 0, 0, 0, time.UTC)
+	if events := cal.EventsBetween(now, now.Add(1*Day), EventsOpts{}); len(events) != 0 {
+		t.Fatalf("expected no events, got %d", len(events))
+	}
+
+	clock := clocker.NewFakeClock(now)
+	queued := make(chan Notification, 1)
+	notifier := NewNotifier(NotifierOpts{
+		EventsOpts: EventsOpts{
+			DefaultReminders: []time.Duration{0},
+		},
+		Location: time.UTC,
+		Clock:    clock,
+		OnQueue:  func(n Notification) { queued <- n },
+	})
+	// The sentinel's reminder is queued on every refresh, which tells when
+	// the refresh is done.
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(cal)
+		state.AddCalendar(newMockCalendar([]Event{{
+			Summary:  "Sentinel",
+			StartsAt: now.Add(1 * time.Hour),
+			EndsAt:   now.Add(2 * time.Hour),
+		}}))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			notifier.Invalidate()
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for refresh %d", i)
+		case n := <-queued:
+			if n.Event.Summary != "Sentinel" {
+				t.Fatalf("unexpected notification for event %q", n.Event.Summary)
+			}
+		}
+	}
+
+	clock.WaitForTimers(2)
+	clock.Advance(1 * time.Hour)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	case n := <-notifications:
+		if n.Event.Summary != "Sentinel" {
+			t.Fatalf("unexpected notification for event %q", n.Event.Summary)
+		}
+	}
+
+	cancel()
+	<-notifier.done
+}
+
+func TestNotifier_shouldSkip(t *testing.T) {
+	now := time.Date(2022, time.November, 4, 12, 0, 0, 0, time.UTC)
+	upcoming := Event{
+		StartsAt: now.Add(1 * time.Hour),
+		EndsAt:   now.Add(2 * time.Hour),
+	}
+
+	tests := []struct {
+		name       string
+		opts       NotifierOpts
+		remindedAt time.Time
+		skip       bool
+	}{
+		{
+			name:       "upcoming",
+			opts:       NotifierOpts{PastGrace: 30 * time.Minute},
+			remindedAt: now.Add(10 * time.Minute),
+			skip:       false,
+		},
+		{
+			name:       "just_missed",
+			opts:       NotifierOpts{PastGrace: 30 * time.Minute},
+			remindedAt: now.Add(-10 * time.Minute),
+			skip:       false,
+		},
+		{
+			name:       "missed_long_ago",
+			opts:       NotifierOpts{PastGrace: 30 * time.Minute},
+			remindedAt: now.Add(-12 * time.Hour),
+			skip:       true,
+		},
+		{
+			name:       "replay_all",
+			opts:       NotifierOpts{},
+			remindedAt: now.Add(-12 * time.Hour),
+			skip:       false,
+		},
+		{
+			name:       "skip_past",
+			opts:       NotifierOpts{SkipPastNotifications: true},
+			remindedAt: now.Add(-10 * time.Minute),
+			skip:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier := NewNotifier(test.opts)
+			notification := Notification{
+				Event:      upcoming,
+				RemindedAt: test.remindedAt,
+			}
+			if skip := notifier.shouldSkip(notification, now, time.Time{}, nil); skip != test.skip {
+				t.Errorf("expected skip %v, got %v", test.skip, skip)
+			}
+		})
+	}
+}
+
+type mockCalendar struct {
+	mu     sync.Mutex
+	events []Event
+	// unloaded, if true, makes EventIDs report that the calendar has not
+	// been loaded yet.
+	unloaded bool
+}
+
+func newMockCalendar(events []Event) *mockCalendar {
+	return &mockCalendar{events: events}
+}
+
+func (c *mockCalendar) addEvents(events []Event) {
+	c.mu.Lock()
+	c.events = append(c.events, events...)
+	c.mu.Unlock()
+}
+
+func (c *mockCalendar) setEvents(events []Event) {
+	c.mu.Lock()
+	c.events = events
+	c.mu.Unlock()
+}
+
+func (c *mockCalendar) setLoaded() {
+	c.mu.Lock()
+	c.unloaded = false
+	c.mu.Unlock()
+}
+
+func (c *mockCalendar) EventIDs(*time.Location) ([]EventID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.unloaded {
+		return nil, false
+	}
+
+	var ids []EventID
+	for _, e := range c.events {
+		if e.UID != "" {
+			ids = append(ids, e.ID())
+		}
+	}
+	return ids, true
+}
+
+func (c *mockCalendar) EventsBetween(start, end time.Time, opts EventsOpts) []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var events []Event
+	for _, e := range c.events {
+		e.Reminders = opts.EventReminders(e)
+		if e.Within(start, end, opts.IncludeReminders) {
+			events = append(events, e)
+		}
+	}
+
+	slices.SortFunc(events, CompareEvent)
+	return events
+}
+
+func TestNotifier_upcomingEvents(t *testing.T) {
+	clock := clocker.NewFakeClock(time.Date(2022, time.November, 4, 12, 0, 0, 0, time.UTC))
+	now := clock.Now()
+
+	notifier := NewNotifier(NotifierOpts{
+		Location: time.UTC,
+		Clock:    clock,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go notifier.Notify(ctx, make(chan Notification))
+
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				Summary:  "later",
+				StartsAt: now.Add(3 * Day),
+				EndsAt:   now.Add(3*Day + time.Hour),
+				Reminders: []Reminder{
+					{RemindAt: now.Add(3*Day - time.Hour)},
+				},
+			},
+			{
+				Summary:  "soon",
+				StartsAt: now.Add(2 * time.Hour),
+				EndsAt:   now.Add(3 * time.Hour),
+				Reminders: []Reminder{
+					{RemindAt: now.Add(time.Hour)},
+					{RemindAt: now.Add(2 * time.Hour)},
+				},
+			},
+			{
+				Summary:  "cancelled",
+				StartsAt: now.Add(4 * time.Hour),
+				EndsAt:   now.Add(5 * time.Hour),
+				Status:   EventCancelled,
+				Reminders: []Reminder{
+					{RemindAt: now.Add(3 * time.Hour)},
+				},
+			},
+			{
+				Summary:   "next_week",
+				StartsAt:  now.Add(8 * Day),
+				EndsAt:    now.Add(8*Day + time.Hour),
+				Reminders: []Reminder{{RemindAt: now.Add(8 * Day)}},
+			},
+		}))
+	})
+
+	notifications := notifier.UpcomingEvents(now, now.Add(7*Day))
+
+	var got []string
+	for _, n := range notifications {
+		got = append(got, n.Event.Summary)
+	}
+	if !slices.Equal(got, []string{"soon", "soon", "later"}) {
+		t.Errorf("unexpected notifications: %q", got)
+	}
+
+	cancel()
+	<-notifier.done
+}
+
+func TestNotifier_replaySince(t *testing.T) {
+	now := time.Now()
+
+	var mu sync.Mutex
+	var skipped int
+
+	notifier := NewNotifier(NotifierOpts{
+		SkipPastNotifications: true,
+		ReplaySince:           now.Add(-1 * time.Minute),
+		OnSkip: func(Notification, SkipReason) {
+			mu.Lock()
+			skipped++
+			mu.Unlock()
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	replayed := now.Add(-30 * time.Second)
+	upcoming := now.Add(200 * time.Millisecond)
+
+	notifier.Update(func(state *NotifierState) {
+		state.AddCalendar(newMockCalendar([]Event{
+			{
+				StartsAt: now.Add(1 * time.Hour),
+				EndsAt:   now.Add(2 * time.Hour),
+				Reminders: []Reminder{
+					// Already processed before the restart.
+					{RemindAt: now.Add(-2 * time.Minute)},
+					// Missed while the notifier was down.
+					{RemindAt: replayed},
+					{RemindAt: upcoming},
+				},
+			},
+		}))
+	})
+
+	for _, expect := range []time.Time{replayed, upcoming} {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for notification")
+		case notification := <-notifications:
+			if !notification.RemindedAt.Equal(expect) {
+				t.Errorf("expected reminder at %v, got %v", expect, notification.RemindedAt)
+			}
+		}
+	}
+
+	cancel()
+	<-notifier.done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if skipped != 1 {
+		t.Errorf("expected 1 skipped notification, got %d", skipped)
+	}
+}
+
+func TestNotifier_replaySinceSameTime(t *testing.T) {
+	now := time.Now()
+
+	notifier := NewNotifier(NotifierOpts{
+		SkipPastNotifications: true,
+		ReplaySince:           now.Add(-1 * time.Minute),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	notifications := make(chan Notification)
+	go func() {
+		if err := notifier.Notify(ctx, notifications); err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	// Two events with the same reminder, due at the same time.
+	remindAt := now.Add(200 * time.Millisecond)
+	cal := newMockCalendar([]Event{
+		{
+			Summary:   "first",
+			StartsAt:  now.Add(1 * time.Hour),
+			EndsAt:    now.Add(2 * time.Hour),
+			Reminders: []Reminder{{RemindAt: remindAt}},
+		},
+		{
+			Summary:   "second",
+			StartsAt:  now.Add(1 * time.Hour),
+			EndsAt:    now.Add(2 * time.Hour),
+			Reminders: []Reminder{{RemindAt: remindAt}},
+		},
+	})
+	notifier.Update(func(state *NotifierState) { state.AddCalendar(cal) })
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for notifications, got %q", got)
+		case notification := <-notifications:
+			got = append(got, notification.Event.Summary)
+		}
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"first", "second"}) {
+		t.Errorf("expected both reminders, got %q", got)
+	}
+
+	// Refreshing doesn't send them again.
+	notifier.Invalidate()
+
+	select {
+	case notification := <-notifications:
+		t.Fatalf("unexpected notification for event %q", notification.Event.Summary)
+	case <-time.After(200 * time.Millisecond):
+	}
 }
@@ -0,0 +1,387 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/pkg/errors"
+	"github.com/teambition/rrule-go"
+)
+
+// parseTimezones builds locations for the calendar's VTIMEZONE components
+// whose TZID is unknown to the system, e.g. because it's a custom name or
+// because the system has no timezone database. Components that can't be
+// understood are skipped.
+func parseTimezones(cal *ical.Calendar) map[string]*time.Location {
+	var zones map[string]*time.Location
+
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			continue
+		}
+
+		tzid := textProp(child.Props, ical.PropTimezoneID)
+		if tzid == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(tzid); err == nil {
+			continue
+		}
+
+		loc, err := vtimezoneLocation(tzid, child)
+		if err != nil {
+			continue
+		}
+
+		if zones == nil {
+			zones = make(map[string]*time.Location)
+		}
+		zones[tzid] = loc
+	}
+
+	return zones
+}
+
+// tzRule is a STANDARD or DAYLIGHT component of a VTIMEZONE.
+type tzRule struct {
+	name   string
+	offset int // seconds east of UTC
+	start  time.Time
+	rrule  string
+}
+
+// vtimezoneLocation builds a location from the most recent STANDARD and
+// DAYLIGHT rules of a VTIMEZONE component. Yearly rules that switch on the
+// nth or last weekday of a month are supported. Otherwise, the zone is assumed
+// to have a fixed offset.
+func vtimezoneLocation(tzid string, comp *ical.Component) (*time.Location, error) {
+	var std, dst *tzRule
+	for _, child := range comp.Children {
+		var latest **tzRule
+		switch child.Name {
+		case ical.CompTimezoneStandard:
+			latest = &std
+		case ical.CompTimezoneDaylight:
+			latest = &dst
+		default:
+			continue
+		}
+
+		rule, err := parseTZRule(child)
+		if err != nil {
+			return nil, err
+		}
+		if *latest == nil || rule.start.After((*latest).start) {
+			*latest = &rule
+		}
+	}
+
+	switch {
+	case std == nil && dst == nil:
+		return nil, errors.New("timezone has no rules")
+	case std == nil:
+		return time.FixedZone(dst.name, dst.offset), nil
+	case dst == nil || dst.rrule == "" || std.rrule == "":
+		return time.FixedZone(std.name, std.offset), nil
+	}
+
+	dstStart, err := posixTransition(dst)
+	if err != nil {
+		return time.FixedZone(std.name, std.offset), nil
+	}
+	dstEnd, err := posixTransition(std)
+	if err != nil {
+		return time.FixedZone(std.name, std.offset), nil
+	}
+
+	// The POSIX TZ string is used by the time package for all times after
+	// the last transition, which, since there are none, is all of them.
+	extend := fmt.Sprintf("<%s>%s<%s>%s,%s,%s",
+		std.name, posixOffset(std.offset),
+		dst.name, posixOffset(dst.offset),
+		dstStart, dstEnd)
+
+	return time.LoadLocationFromTZData(tzid, tzif(std.name, std.offset, extend))
+}
+
+func parseTZRule(comp *ical.Component) (tzRule, error) {
+	var rule tzRule
+
+	offset := comp.Props.Get(ical.PropTimezoneOffsetTo)
+	if offset == nil {
+		return rule, errors.New("missing TZOFFSETTO")
+	}
+
+	var err error
+	rule.offset, err = parseUTCOffset(offset.Value)
+	if err != nil {
+		return rule, errors.Wrap(err, "invalid TZOFFSETTO")
+	}
+
+	// The start is in the local time before the transition, but only its
+	// date and time of day are needed.
+	if start := comp.Props.Get(ical.PropDateTimeStart); start != nil {
+		rule.start, err = time.Parse("20060102T150405", start.Value)
+		if err != nil {
+			return rule, errors.Wrap(err, "invalid DTSTART")
+		}
+	}
+
+	if rrule := comp.Props.Get(ical.PropRecurrenceRule); rrule != nil {
+		rule.rrule = rrule.Value
+	}
+
+	rule.name = posixName(textProp(comp.Props, ical.PropTimezoneName))
+	if rule.name == "" {
+		if comp.Name == ical.CompTimezoneDaylight {
+			rule.name = "DST"
+		} else {
+			rule.name = "STD"
+		}
+	}
+
+	return rule, nil
+}
+
+// parseUTCOffset parses a UTC offset like "-0800" or "+053000" into seconds
+// east of UTC.
+func parseUTCOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 {
+		return 0, errors.Errorf("invalid UTC offset %q", s)
+	}
+
+	var sign int
+	switch s[0] {
+	case '+':
+		sign = 1
+	case '-':
+		sign = -1
+	default:
+		return 0, errors.Errorf("invalid UTC offset %q", s)
+	}
+
+	var parts [3]int
+	for i := 0; 1+i*2 < len(s); i++ {
+		n, err := strconv.Atoi(s[1+i*2 : 3+i*2])
+		if err != nil {
+			return 0, errors.Errorf("invalid UTC offset %q", s)
+		}
+		parts[i] = n
+	}
+
+	return sign * (parts[0]*3600 + parts[1]*60 + parts[2]), nil
+}
+
+// posixName sanitizes a timezone name for use in a quoted POSIX TZ string.
+func posixName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '+', r == '-':
+			return r
+		default:
+			return -1
+		}
+	}, name)
+	if len(name) < 3 {
+		return ""
+	}
+	return name
+}
+
+// posixOffset formats a UTC offset for a POSIX TZ string, which counts hours
+// west of UTC.
+func posixOffset(offset int) string {
+	return posixClock(-offset)
+}
+
+func posixClock(secs int) string {
+	var sign string
+	if secs < 0 {
+		sign = "-"
+		secs = -secs
+	}
+	return fmt.Sprintf("%s%d:%02d:%02d", sign, secs/3600, secs/60%60, secs%60)
+}
+
+var posixWeekdays = map[string]int{
+	"SU": 0, "MO": 1, "TU": 2, "WE": 3, "TH": 4, "FR": 5, "SA": 6,
+}
+
+// posixTransition converts the yearly recurrence of a timezone rule into the
+// "Mm.w.d/time" form of a POSIX TZ string.
+func posixTransition(rule *tzRule) (string, error) {
+	var month, week, weekday int
+	var yearly bool
+
+	for _, part := range strings.Split(rule.rrule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "FREQ":
+			yearly = value == "YEARLY"
+		case "BYMONTH":
+			m, err := strconv.Atoi(value)
+			if err != nil || m < 1 || m > 12 {
+				return "", errors.Errorf("unsupported BYMONTH %q", value)
+			}
+			month = m
+		case "BYDAY":
+			if len(value) < 3 {
+				return "", errors.Errorf("unsupported BYDAY %q", value)
+			}
+			n, err := strconv.Atoi(value[:len(value)-2])
+			if err != nil || n == 0 || n < -1 || n > 5 {
+				return "", errors.Errorf("unsupported BYDAY %q", value)
+			}
+			d, ok := posixWeekdays[value[len(value)-2:]]
+			if !ok {
+				return "", errors.Errorf("unsupported BYDAY %q", value)
+			}
+			if n == -1 {
+				// Week 5 means the last week of the month.
+				n = 5
+			}
+			week, weekday = n, d
+		case "UNTIL", "COUNT":
+			return "", errors.New("bounded recurrences are not supported")
+		case "BYMONTHDAY", "BYYEARDAY", "BYWEEKNO", "BYSETPOS":
+			return "", errors.Errorf("unsupported %s", key)
+		}
+	}
+
+	if !yearly || month == 0 || week == 0 {
+		return "", errors.Errorf("unsupported recurrence %q", rule.rrule)
+	}
+
+	clock := rule.start.Hour()*3600 + rule.start.Minute()*60 + rule.start.Second()
+	return fmt.Sprintf("M%d.%d.%d/%s", month, week, weekday, posixClock(clock)), nil
+}
+
+// tzif encodes a TZif version 2 file without any transitions, so that the
+// time package uses the POSIX TZ string in extend for all times. The zone
+// before the first transition is given by name and offset, but it is never
+// used.
+func tzif(name string, offset int, extend string) []byte {
+	var b bytes.Buffer
+	abbr := name + "\x00"
+
+	// The version 1 and version 2 data blocks are identical since there are
+	// no transition times to encode.
+	for i := 0; i < 2; i++ {
+		b.WriteString("TZif2")
+		b.Write(make([]byte, 15))
+		// isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt
+		for _, n := range []int{0, 0, 0, 0, 1, len(abbr)} {
+			binary.Write(&b, binary.BigEndian, uint32(n))
+		}
+
+		// The only local time type.
+		binary.Write(&b, binary.BigEndian, int32(offset))
+		b.WriteByte(0) // isdst
+		b.WriteByte(0) // abbreviation index
+		b.WriteString(abbr)
+	}
+
+	b.WriteString("\n" + extend + "\n")
+	return b.Bytes()
+}
+
+// dateTime parses a date-time property like ical.Prop.DateTime, except that
+// TZIDs defined by the calendar's VTIMEZONE components are also resolved.
+func (c *ICSCalendar) dateTime(prop *ical.Prop, loc *time.Location) (time.Time, error) {
+	if tzid := prop.Params.Get(ical.PropTimezoneID); tzid != "" {
+		if zone, ok := c.zones[tzid]; ok {
+			local := *prop
+			local.Params = maps.Clone(prop.Params)
+			local.Params.Del(ical.PropTimezoneID)
+			return local.DateTime(zone)
+		}
+	}
+	return prop.DateTime(loc)
+}
+
+// dateTimeStart is like ical.Event.DateTimeStart.
+func (c *ICSCalendar) dateTimeStart(event ical.Event, loc *time.Location) (time.Time, error) {
+	if prop := event.Props.Get(ical.PropDateTimeStart); prop != nil {
+		return c.dateTime(prop, loc)
+	}
+	return time.Time{}, nil
+}
+
+// dateTimeEnd is like ical.Event.DateTimeEnd. Events without a DTEND end
+// after their DURATION, or after a day if they're all-day events.
+func (c *ICSCalendar) dateTimeEnd(event ical.Event, loc *time.Location) (time.Time, error) {
+	if prop := event.Props.Get(ical.PropDateTimeEnd); prop != nil {
+		return c.dateTime(prop, loc)
+	}
+
+	startProp := event.Props.Get(ical.PropDateTimeStart)
+	if startProp == nil {
+		return time.Time{}, nil
+	}
+
+	start, err := c.dateTime(startProp, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var dur time.Duration
+	if durProp := event.Props.Get(ical.PropDuration); durProp != nil {
+		dur, err = durProp.Duration()
+		if err != nil {
+			return time.Time{}, err
+		}
+	} else if startProp.ValueType() == ical.ValueDate {
+		dur = Day
+	}
+
+	return start.Add(dur), nil
+}
+
+// recurrenceSet is like ical.Component.RecurrenceSet. It returns nil if the
+// event doesn't recur.
+func (c *ICSCalendar) recurrenceSet(event ical.Event, loc *time.Location) (*rrule.Set, error) {
+	roption, err := event.Props.RecurrenceRule()
+	if err != nil || roption == nil {
+		return nil, err
+	}
+
+	dtstart, err := c.dateTimeStart(event, loc)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DTSTART")
+	}
+
+	// A local UNTIL that is compared as UTC would let the series run an
+	// occurrence past its end in timezones ahead of UTC.
+	roption.Until = localUntil(event.Props.Get(ical.PropRecurrenceRule).Value, roption.Until, dtstart.Location())
+
+	rule, err := rrule.NewRRule(*roption)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid RRULE")
+	}
+
+	var set rrule.Set
+	set.RRule(rule)
+	set.DTStart(dtstart)
+
+	for _, prop := range event.Props[ical.PropExceptionDates] {
+		// EXDATE may list multiple dates, which share the property's TZID
+		// and VALUE parameters.
+		for _, value := range strings.Split(prop.Value, ",") {
+			item := prop
+			item.Value = value
+			exdate, err := c.dateTime(&item, loc)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid EXDATE")
+			}
+			set.ExDate(exdate)
+		}
+	}
+
+	return &set, nil
+}
@@ -0,0 +1,174 @@
+package clocker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers and tickers. It allows replacing
+// the real clock, e.g. with a FakeClock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer creates a timer that fires once after d.
+	NewTimer(d time.Duration) Timer
+	// NewTicker creates a ticker like NewAnchoredTicker, which is also
+	// stopped once ctx is done.
+	NewTicker(ctx context.Context, d time.Duration, anchor time.Time) *Ticker
+}
+
+// Timer is a timer created by a Clock. It behaves like time.Timer.
+type Timer interface {
+	// C returns the channel that the time is sent on when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+	// Reset changes the timer to fire after d. It returns false if the timer
+	// had already fired or been stopped.
+	Reset(d time.Duration) bool
+}
+
+// Real is the real clock, which uses the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (c realClock) NewTicker(ctx context.Context, d time.Duration, anchor time.Time) *Ticker {
+	return newTicker(ctx, c, d, anchor)
+}
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// FakeClock is a Clock whose time only moves when it is advanced. It is safe
+// for concurrent use.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+// NewFakeClock creates a new fake clock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+	c.cond.L = &c.mu
+	return c
+}
+
+// Now implements Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements Clock.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker implements Clock.
+func (c *FakeClock) NewTicker(ctx context.Context, d time.Duration, anchor time.Time) *Ticker {
+	return newTicker(ctx, c, d, anchor)
+}
+
+// Advance moves the clock forward by d, firing the timers that are due in
+// order of their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for t := range c.timers {
+			if !t.deadline.After(end) && (next == nil || t.deadline.Before(next.deadline)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		if next.deadline.After(c.now) {
+			c.now = next.deadline
+		}
+		delete(c.timers, next)
+
+		// Like the runtime's timers, drop the tick if the channel is full.
+		select {
+		case next.c <- c.now:
+		default:
+		}
+	}
+	c.now = end
+	c.cond.Broadcast()
+}
+
+// WaitForTimers blocks until at least n timers are pending. It is useful to
+// wait for another goroutine to set up its timers before advancing the clock.
+func (c *FakeClock) WaitForTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, pending := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	t.clock.cond.Broadcast()
+	return pending
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, pending := t.clock.timers[t]
+	t.deadline = t.clock.now.Add(d)
+
+	if d <= 0 {
+		delete(t.clock.timers, t)
+		select {
+		case t.c <- t.clock.now:
+		default:
+		}
+	} else {
+		t.clock.timers[t] = struct{}{}
+	}
+
+	t.clock.cond.Broadcast()
+	return pending
+}
@@ -0,0 +1,98 @@
+package clocker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock_timer(t *testing.T) {
+	start := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Minute)
+	if !stopped.Stop() {
+		t.Fatal("expected stopping a pending timer to return true")
+	}
+
+	clock.Advance(30 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case now := <-timer.C():
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Errorf("timer fired at %v, expected %v", now, start.Add(time.Minute))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	select {
+	case <-stopped.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	if now := clock.Now(); !now.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("clock is at %v, expected %v", now, start.Add(90*time.Second))
+	}
+}
+
+func TestFakeClock_ticker(t *testing.T) {
+	start := time.Date(2023, time.August, 1, 12, 0, 30, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	ticker := clock.NewTicker(context.Background(), time.Minute, time.Time{})
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clock.WaitForTimers(1)
+		clock.Advance(time.Minute)
+
+		expect := start.Truncate(time.Minute).Add(time.Duration(i) * time.Minute)
+		select {
+		case tick := <-ticker.C:
+			if !tick.Equal(expect) {
+				t.Errorf("tick %d at %v, expected %v", i, tick, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for tick %d", i)
+		}
+	}
+}
+
+func TestFakeClock_tickerContext(t *testing.T) {
+	clock := NewFakeClock(time.Date(2023, time.August, 1, 12, 0, 30, 0, time.UTC))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := clock.NewTicker(ctx, time.Minute, time.Time{})
+
+	clock.WaitForTimers(1)
+	cancel()
+
+	// The ticker's goroutine stops its timer once the context is done.
+	deadline := time.Now().Add(time.Second)
+	for {
+		clock.mu.Lock()
+		pending := len(clock.timers)
+		clock.mu.Unlock()
+
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ticker timer still pending after the context is done")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Stopping the ticker afterwards, even twice, is fine.
+	ticker.Stop()
+	ticker.Stop()
+}
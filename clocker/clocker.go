@@ -1,6 +1,8 @@
 package clocker
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
@@ -8,10 +10,31 @@ import (
 type Ticker struct {
 	C    <-chan time.Time
 	done chan struct{}
+	stop sync.Once
 }
 
-// NewTicker returns a new ticker, similar to stdlib's time.Ticker
+// NewTicker returns a new ticker, similar to stdlib's time.Ticker. Ticks are
+// aligned to multiples of d since the zero time, so frames that don't evenly
+// divide an hour or a day may tick at surprising times. Use NewAnchoredTicker
+// to control the alignment.
 func NewTicker(d time.Duration) *Ticker {
+	return NewAnchoredTicker(d, time.Time{})
+}
+
+// NewAnchoredTicker returns a new ticker whose ticks are aligned to multiples of
+// d since the given anchor. For example, an anchor at local midnight with a
+// 24-hour frame ticks at every local midnight.
+func NewAnchoredTicker(d time.Duration, anchor time.Time) *Ticker {
+	return newTicker(context.Background(), Real, d, anchor)
+}
+
+// NewTickerContext is like NewTicker, except that the ticker is also stopped
+// once ctx is done.
+func NewTickerContext(ctx context.Context, d time.Duration) *Ticker {
+	return newTicker(ctx, Real, d, time.Time{})
+}
+
+func newTicker(ctx context.Context, clock Clock, d time.Duration, anchor time.Time) *Ticker {
 	c := make(chan time.Time)
 	t := &Ticker{
 		C:    c,
@@ -20,14 +43,17 @@ func NewTicker(d time.Duration) *Ticker {
 
 	go func() {
 		// Make a timer while rounding it to the next tick frame
-		timer := time.NewTimer(getDurationForNextFrame(d))
+		timer := clock.NewTimer(getDurationForNextFrame(clock.Now(), anchor, d))
 		for {
 			select {
 			case <-t.done:
 				timer.Stop()
 				return
+			case <-ctx.Done():
+				timer.Stop()
+				return
 				// Hang until the timer ends, then send that over the channel
-			case t := <-timer.C:
+			case t := <-timer.C():
 				// Either send the tick to the channel, or drop it if it
 				// has not been consumed
 				select {
@@ -35,7 +61,7 @@ func NewTicker(d time.Duration) *Ticker {
 				default:
 				}
 				// Reset the timer, loop restarts
-				timer.Reset(getDurationForNextFrame(d))
+				timer.Reset(getDurationForNextFrame(clock.Now(), anchor, d))
 			}
 		}
 	}()
@@ -43,20 +69,23 @@ func NewTicker(d time.Duration) *Ticker {
 	return t
 }
 
-// Stop stops the ticker
+// Stop stops the ticker. It may be called more than once.
 func (t *Ticker) Stop() {
-	close(t.done)
+	t.stop.Do(func() { close(t.done) })
 }
 
-// Tick is a shorthand for NewTicker(d).C.
+// Tick is a shorthand for NewTicker(d).C. The ticker can never be stopped, so
+// prefer NewTickerContext for tickers that don't live as long as the program.
 func Tick(d time.Duration) <-chan time.Time {
 	return NewTicker(d).C
 }
 
-func getDurationForNextFrame(frame time.Duration) time.Duration {
-	tick := time.Now().Round(frame)
-	if s := tick.Sub(time.Now()); s > 0 {
-		return s
-	}
-	return tick.Add(frame).Sub(time.Now())
+// getDurationForNextFrame returns the duration from now until the next frame
+// strictly after now. Frames are aligned to the anchor.
+func getDurationForNextFrame(now, anchor time.Time, frame time.Duration) time.Duration {
+	// Truncate only aligns to the zero time, so shift now by the anchor's
+	// offset within a frame before truncating.
+	offset := anchor.Sub(anchor.Truncate(frame))
+	tick := now.Add(-offset).Truncate(frame).Add(offset).Add(frame)
+	return tick.Sub(now)
 }
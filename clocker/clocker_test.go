@@ -37,3 +37,82 @@ func TestTickerDrift(t *testing.T) {
 		t.Fatalf("Tick millisecond is not a multiple of 200: %d", ms)
 	}
 }
+
+func TestGetDurationForNextFrame(t *testing.T) {
+	base := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		anchor time.Time
+		frame  time.Duration
+		expect time.Duration
+	}{
+		{
+			name:   "minute",
+			now:    base.Add(10 * time.Second),
+			frame:  time.Minute,
+			expect: 50 * time.Second,
+		},
+		{
+			name:   "on_boundary",
+			now:    base,
+			frame:  time.Minute,
+			expect: time.Minute,
+		},
+		{
+			// 7-minute frames since the zero time don't line up with the
+			// hour.
+			name:   "seven_minutes",
+			now:    base,
+			frame:  7 * time.Minute,
+			expect: base.Truncate(7 * time.Minute).Add(7 * time.Minute).Sub(base),
+		},
+		{
+			name:   "seven_minutes_anchored",
+			now:    base.Add(1 * time.Minute),
+			anchor: base,
+			frame:  7 * time.Minute,
+			expect: 6 * time.Minute,
+		},
+		{
+			// 24 hours is 205 frames and 5 minutes, so the frames are
+			// aligned to base+5m.
+			name:   "anchor_in_future",
+			now:    base.Add(1 * time.Minute),
+			anchor: base.Add(24 * time.Hour),
+			frame:  7 * time.Minute,
+			expect: 4 * time.Minute,
+		},
+		{
+			name:   "local_midnight",
+			now:    time.Date(2023, time.August, 1, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60)),
+			anchor: time.Date(2023, time.August, 1, 0, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+			frame:  24 * time.Hour,
+			expect: 30 * time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := getDurationForNextFrame(test.now, test.anchor, test.frame)
+			if d != test.expect {
+				t.Fatalf("expected %v, got %v", test.expect, d)
+			}
+		})
+	}
+}
+
+func TestAnchoredTicker(t *testing.T) {
+	anchor := time.Now().Truncate(time.Second).Add(70 * time.Millisecond)
+
+	ticker := NewAnchoredTicker(200*time.Millisecond, anchor)
+	defer ticker.Stop()
+
+	tick := <-ticker.C
+
+	offset := tick.Sub(anchor) % (200 * time.Millisecond)
+	if offset < 0 || offset > 20*time.Millisecond {
+		t.Fatalf("tick is not aligned to the anchor, offset %v", offset)
+	}
+}
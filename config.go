@@ -1,24 +1,297 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"net/http"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
 )
 
 type config struct {
-	Timezone           timezoneValue    `json:"timezone"`
+	Timezone           *timezoneValue   `json:"timezone"`
 	Calendars          []calendarConfig `json:"calendars"`
 	RefreshFrequency   durationValue    `json:"refresh_frequency"`
 	EventNotifications []durationValue  `json:"event_notifications"`
+	// CalendarSources are external sources that provide additional calendars
+	// on startup.
+	CalendarSources []calendarSourceConfig `json:"calendar_sources"`
+	// OnlyNearestReminder, if true, only sends the reminder closest to the
+	// start of each event.
+	OnlyNearestReminder bool `json:"only_nearest_reminder"`
+	// LookaheadWindow is how far ahead to look for reminders. It defaults to
+	// a day.
+	LookaheadWindow durationValue `json:"lookahead_window"`
+	// IncludeVALARM, if true, also sends reminders for the alarms that
+	// calendar apps attach to events, on top of event_notifications and the
+	// reminders in event descriptions.
+	IncludeVALARM bool `json:"include_valarm"`
+	// MinEventDuration and MaxEventDuration, if non-zero, exclude events
+	// that are shorter or longer than them.
+	MinEventDuration durationValue `json:"min_event_duration"`
+	MaxEventDuration durationValue `json:"max_event_duration"`
+	// CollapseOnFirstSighting, if true, sends a single heads up instead of
+	// all past-due reminders for upcoming events that are seen for the
+	// first time, e.g. on startup or when an event is added last minute.
+	CollapseOnFirstSighting bool `json:"collapse_on_first_sighting"`
+	// AnnounceNewEvents, if true, sends a notification when an event within
+	// AnnounceWindow (a week by default) is added to a calendar after it was
+	// first loaded. Events are told apart by their UID.
+	AnnounceNewEvents bool          `json:"announce_new_events"`
+	AnnounceWindow    durationValue `json:"announce_window"`
+	// Retention is how long events are remembered after they end, for
+	// remind_if_updated and collapse_on_first_sighting. It also governs how
+	// long notifications are kept in DeliveredFile, although never for less
+	// than ReplayMaxAge, since replayed notifications are checked against it.
+	Retention durationValue `json:"retention"`
+	// BatchWindow, if non-zero, combines the reminders of a calendar that
+	// are due within this duration of each other into a single message,
+	// which is sent when the first of them is due.
+	BatchWindow durationValue `json:"batch_window"`
+	// RemindIfUpdated, if true, sends another notification when an event
+	// that was already reminded about is rescheduled.
+	RemindIfUpdated bool `json:"remind_if_updated"`
+	// DefaultRemindersMode determines which events get the reminders of
+	// event_notifications. It is either "always" (default) or
+	// "only_if_none_parsed", which skips them for events whose description
+	// has its own reminders.
+	DefaultRemindersMode string `json:"default_reminders_mode"`
+	// NotificationOrder is the order of notifications that are sent at the
+	// same time. It is one of "start_time" (default), "priority" or
+	// "calendar".
+	NotificationOrder string `json:"notification_order"`
+	// PastGrace, if non-zero, is how long after their time reminders that
+	// were missed, e.g. while the daemon was down, are still sent, as long as
+	// their event hasn't started yet. If zero, missed reminders are skipped.
+	// Reminders replayed from StateFile are also limited by it.
+	PastGrace durationValue `json:"past_grace"`
+	// DeliverTimeout, if non-zero, is how long a due notification may wait
+	// for the previous ones to be sent. Notifications that wait longer are
+	// dropped with a warning. If zero, they wait indefinitely.
+	DeliverTimeout durationValue `json:"deliver_timeout"`
+	// StateFile, if not empty, is the file to persist the time of the last
+	// processed reminder to. On startup, reminders missed since then are
+	// sent, as long as they are not older than ReplayMaxAge (a day by
+	// default).
+	StateFile    string        `json:"state_file"`
+	ReplayMaxAge durationValue `json:"replay_max_age"`
+	// DeliveredFile, if not empty, is the file to record the delivered
+	// notifications in, so that they are never sent twice, e.g. when the
+	// daemon is restarted soon after sending them. The file is compacted
+	// hourly according to Retention.
+	DeliveredFile string `json:"delivered_file"`
+	// HTTPAddr, if not empty, is the address to serve the /healthz, /readyz
+	// and /metrics endpoints on, e.g. ":8080".
+	HTTPAddr string `json:"http_addr"`
 }
 
+func (c config) replayMaxAge() time.Duration {
+	if d := c.ReplayMaxAge.Duration(); d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// deliveredRetention returns how long notifications are kept in the delivered
+// file after their event ends.
+func (c config) deliveredRetention() time.Duration {
+	if d := c.Retention.Duration(); d > c.replayMaxAge() {
+		return d
+	}
+	return c.replayMaxAge()
+}
+
+// defaultSilentActions is the default of calendarConfig.SilentActions.
+var defaultSilentActions = []calendar.ReminderAction{calendar.ReminderActionDisplay}
+
 type calendarConfig struct {
 	ICalURL         string `json:"ical_url"`
 	WebhookURL      string `json:"webhook_url"`
 	MessageTemplate string `json:"message_template"`
+	// Username and Password, if set, are sent as HTTP Basic Auth credentials
+	// when fetching the calendar.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// AuthorizationHeader, if set, is sent as the Authorization header when
+	// fetching the calendar, e.g. "Bearer <token>". It takes precedence over
+	// Username and Password.
+	AuthorizationHeader string `json:"authorization_header"`
+	// FetchTimeout bounds each request fetching the calendar. It defaults to
+	// 30 seconds.
+	FetchTimeout durationValue `json:"fetch_timeout"`
+	// ThreadID, if set, is the thread within the webhook's channel to post
+	// messages in.
+	ThreadID discord.ChannelID `json:"thread_id"`
+	// Timezone, if set, overrides the global timezone for this calendar. It
+	// determines the calendar's day boundaries and the timezone of its
+	// floating times.
+	Timezone *timezoneValue `json:"timezone"`
+	// ReminderPattern is a regular expression matching reminder directives
+	// in event descriptions, e.g. "Discord reminder: (?P<duration>.+?) prior".
+	// It must have exactly one capture group, which is the duration before
+	// the event. Matches are removed from the description when rendering.
+	ReminderPattern string `json:"reminder_pattern"`
+	// Categories, if not empty, limits the calendar to events with any of
+	// these categories. ExcludeCategories drops the events with any of them.
+	// Categories are compared case-insensitively.
+	Categories        []string `json:"categories"`
+	ExcludeCategories []string `json:"exclude_categories"`
+	// ExcludeSummary, if set, is a regular expression dropping the events
+	// whose summary matches it, e.g. "^(Focus time|Out of office)$".
+	ExcludeSummary string `json:"exclude_summary"`
+	// EmbedURLTemplate is a template for the link of the embed's title. It is
+	// executed against the notification, and must produce an absolute URL.
+	// An empty result leaves the embed without a link.
+	EmbedURLTemplate string `json:"embed_url_template"`
+	// Embed configures the color and the fields of the embed.
+	Embed embedConfig `json:"embed"`
+	// EmbedStyles overrides the embed appearance for each notification kind,
+	// which is one of "reminder", "updated", "cancelled" or "announced".
+	EmbedStyles map[string]embedStyleConfig `json:"embed_styles"`
+	// WebhookUsername, if not empty, overrides the webhook's username for
+	// notifications. It is a template executed against the notification, so
+	// it may differ per event. An empty result keeps the default username.
+	WebhookUsername string `json:"webhook_username"`
+	// WebhookAvatarURL, if not empty, overrides the webhook's avatar for
+	// notifications.
+	WebhookAvatarURL string `json:"webhook_avatar_url"`
+	// MaxEmbedFields and MaxEmbedDescription cap the number of fields and the
+	// length of the description of the embed. They default to, and cannot
+	// exceed, Discord's limits.
+	MaxEmbedFields      int `json:"max_embed_fields"`
+	MaxEmbedDescription int `json:"max_embed_description"`
+	// ShowTimezone, if true, adds the event's start time in the configured
+	// timezone to the embed, alongside Discord's localized timestamp.
+	ShowTimezone bool `json:"show_timezone"`
+	// ShowAttendees, if true, adds the event's organizer and attendees to the
+	// embed.
+	ShowAttendees bool `json:"show_attendees"`
+	// WeeklyOverview, if set, posts an overview of the upcoming events once a
+	// week.
+	WeeklyOverview *overviewConfig `json:"weekly_overview"`
+	// DefaultLocation is shown as the location of events that have neither
+	// a LOCATION nor a URL.
+	DefaultLocation string `json:"default_location"`
+	// Prefix and Suffix are prepended and appended verbatim to the rendered
+	// message template, e.g. for role mentions or signatures.
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	// MaxInFlight is the maximum number of concurrent requests to the
+	// webhook. It defaults to 1, which keeps messages in order.
+	MaxInFlight int `json:"max_in_flight"`
+	// MaxMessagesPerMinute, if non-zero, paces the requests to the webhook
+	// so that no more than this many are made per minute, while still
+	// allowing them in bursts. Requests that Discord rate limits anyway are
+	// retried once the rate limit is over.
+	MaxMessagesPerMinute int `json:"max_messages_per_minute"`
+	// LiveCountdown, if non-zero, enables a live countdown for notifications
+	// sent within this duration before the event starts. The message is
+	// edited every minute until the event starts.
+	LiveCountdown durationValue `json:"live_countdown"`
+	// RequestTimeout bounds each webhook request, independently of how long
+	// the notification stays valid. It defaults to 15 seconds.
+	RequestTimeout durationValue `json:"request_timeout"`
+	// SilentActions lists the reminder actions whose notifications are sent
+	// without pinging anyone. Reminders of any other action, e.g. "AUDIO",
+	// are sent normally. It defaults to "DISPLAY", so that the visual alarms
+	// of include_valarm stay silent; set it to an empty list to ping for all
+	// of them. Default reminders use the "DISCORD" action, so they are only
+	// silent if it is listed.
+	SilentActions []calendar.ReminderAction `json:"silent_actions"`
+	// CancelledMessages is what to do with the messages that were already
+	// sent for an event once it is cancelled. It is one of "keep" (default),
+	// which sends a new message, "edit", which replaces the sent messages
+	// with the cancellation, or "delete". Editing and deleting require
+	// remind_if_updated, which the config is rejected without.
+	CancelledMessages string `json:"cancelled_messages"`
+	// Destinations maps reminder actions, e.g. "DISCORD" or "EMAIL", to where
+	// their notifications are delivered, which is either "webhook" or
+	// "email". Reminders of actions that aren't listed are dropped. If empty,
+	// all notifications are delivered to the webhook. Notifications that
+	// aren't triggered by a reminder, e.g. announcements, always go to the
+	// webhook.
+	Destinations map[calendar.ReminderAction]string `json:"destinations"`
+	// Email configures the "email" destination.
+	Email *emailConfig `json:"email"`
+}
+
+// silentActions returns SilentActions, or defaultSilentActions if it isn't
+// set.
+func (c calendarConfig) silentActions() []calendar.ReminderAction {
+	if c.SilentActions == nil {
+		return defaultSilentActions
+	}
+	return c.SilentActions
+}
+
+// icalHeader returns the headers to send when fetching the calendar.
+func (c calendarConfig) icalHeader() http.Header {
+	switch {
+	case c.AuthorizationHeader != "":
+		return http.Header{"Authorization": {c.AuthorizationHeader}}
+	case c.Username != "" || c.Password != "":
+		credentials := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		return http.Header{"Authorization": {"Basic " + credentials}}
+	default:
+		return nil
+	}
+}
+
+// onlineCalendar creates the calendar to fetch from ICalURL.
+func (c calendarConfig) onlineCalendar() *calendar.OnlineICSCalendar {
+	cal := calendar.NewOnlineICSCalendar(c.ICalURL, c.icalHeader())
+	if d := c.FetchTimeout.Duration(); d > 0 {
+		cal.Client = &http.Client{Timeout: d}
+	}
+	return cal
+}
+
+// location returns the calendar's timezone, falling back to the given global
+// one.
+func (c calendarConfig) location(global *time.Location) *time.Location {
+	if c.Timezone != nil {
+		return c.Timezone.Location()
+	}
+	return global
+}
+
+// defaultRequestTimeout is the default timeout of a single webhook request.
+const defaultRequestTimeout = 15 * time.Second
+
+func (c calendarConfig) requestTimeout() time.Duration {
+	if d := c.RequestTimeout.Duration(); d > 0 {
+		return d
+	}
+	return defaultRequestTimeout
+}
+
+type overviewConfig struct {
+	// At is the time of day to post the overview at.
+	At clockValue `json:"at"`
+	// Weekday is the day of the week to post the overview on.
+	Weekday weekdayValue `json:"weekday"`
+	// Window is how far ahead to look for events. It defaults to a week.
+	Window durationValue `json:"window"`
+	// MinEvents is the minimum number of events in the window for the
+	// overview to be sent. It defaults to 1.
+	MinEvents int `json:"min_events"`
+	// EmptyMessage, if not empty, is sent instead of the overview when there
+	// are fewer than MinEvents events.
+	EmptyMessage string `json:"empty_message"`
+}
+
+func (c overviewConfig) minEvents() int {
+	if c.MinEvents < 1 {
+		return 1
+	}
+	return c.MinEvents
 }
 
 func parseConfigFiles(paths []string) (*config, error) {
@@ -90,3 +363,88 @@ func (t *timezoneValue) UnmarshalJSON(b []byte) error {
 	*t = timezoneValue(*loc)
 	return nil
 }
+
+// Location returns the timezone as a *time.Location. If no timezone is
+// configured, the system's local time is used.
+func (t *timezoneValue) Location() *time.Location {
+	if t == nil {
+		return time.Local
+	}
+	return (*time.Location)(t)
+}
+
+// clockValue is a time of day in the "15:04" format, stored as the duration
+// since midnight.
+type clockValue time.Duration
+
+func (c *clockValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "failed to decode time of day")
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse time of day")
+	}
+
+	*c = clockValue(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+	return nil
+}
+
+// On returns the time of day on the same day as t, in t's location.
+func (c clockValue) On(t time.Time) time.Time {
+	d := time.Duration(c)
+	y, m, day := t.Date()
+	return time.Date(y, m, day, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, t.Location())
+}
+
+type weekdayValue time.Weekday
+
+func (w *weekdayValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "failed to decode weekday")
+	}
+
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			*w = weekdayValue(d)
+			return nil
+		}
+	}
+
+	return errors.Errorf("unknown weekday %q", s)
+}
+
+// colorValue is a color in the "#rrggbb" format.
+type colorValue int32
+
+func (c *colorValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "failed to decode color")
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return errors.Errorf("invalid color %q, must be in the #rrggbb format", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return errors.Wrapf(err, "invalid color %q", s)
+	}
+
+	*c = colorValue(v)
+	return nil
+}
+
+// restartRequired returns true if the configs differ in more than their
+// calendars, which are the only part of the config that is reloaded live.
+func restartRequired(old, cur *config) bool {
+	a, b := *old, *cur
+	a.Calendars, b.Calendars = nil, nil
+	a.CalendarSources, b.CalendarSources = nil, nil
+	return !reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCalendarConfig_icalHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    calendarConfig
+		expect http.Header
+	}{
+		{"none", calendarConfig{}, nil},
+		{
+			"basic",
+			calendarConfig{Username: "user", Password: "pass"},
+			http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}},
+		},
+		{
+			"authorization_header",
+			calendarConfig{Username: "user", AuthorizationHeader: "Bearer token"},
+			http.Header{"Authorization": {"Bearer token"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, test.cfg.icalHeader())
+		})
+	}
+}
+
+func TestColorValue(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect colorValue
+		err    bool
+	}{
+		{`"#2c91c6"`, 0x2c91c6, false},
+		{`"2C91C6"`, 0x2c91c6, false},
+		{`"#fff"`, 0, true},
+		{`"#2c91cg"`, 0, true},
+		{`"-2c91c"`, 0, true},
+		{`2921926`, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			var c colorValue
+			err := json.Unmarshal([]byte(test.in), &c)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expect, c)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"libdb.so/discord-ical-reminder/clocker"
+)
+
+// runLiveCountdown edits the message with the given ID every minute until the
+// event starts, appending the remaining time to the given content. It gives up
+// on the first failed edit so that it never fights the webhook rate limit.
+func runLiveCountdown(ctx context.Context, cal *trackedCalendar, messageID discord.MessageID, content string, startsAt time.Time) {
+	ctx, cancel := context.WithDeadline(ctx, startsAt.Add(time.Minute))
+	defer cancel()
+
+	ticker := clocker.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			remaining := startsAt.Sub(now).Round(time.Minute)
+
+			err := cal.withWebhook(ctx, func(c *webhook.Client) error {
+				_, err := editMessage(c, cal.Config.ThreadID, messageID, webhook.EditMessageData{
+					Content: option.NewNullableString(countdownContent(content, remaining)),
+				})
+				return err
+			})
+			if err != nil {
+				slog.WarnContext(ctx,
+					"failed to update live countdown, giving up",
+					"calendar", cal.Config.ICalURL,
+					"message_id", messageID,
+					"error", err)
+				return
+			}
+
+			if remaining <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// countdownContent appends a human-readable countdown to the given content.
+func countdownContent(content string, remaining time.Duration) string {
+	countdown := "Starting now!"
+	if remaining = remaining.Round(time.Minute); remaining > 0 {
+		countdown = fmt.Sprintf("Starts in %s.", humanDuration(remaining))
+	}
+	if content == "" {
+		return countdown
+	}
+	return content + "\n" + countdown
+}
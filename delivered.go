@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+	"libdb.so/discord-ical-reminder/clocker"
+)
+
+// deliveredCompactInterval is how often the delivered store is compacted.
+const deliveredCompactInterval = time.Hour
+
+// deliveredKey identifies a delivered notification.
+type deliveredKey struct {
+	Calendar   string                    `json:"calendar"`
+	UID        string                    `json:"uid"`
+	Kind       calendar.NotificationKind `json:"kind,omitempty"`
+	Action     calendar.ReminderAction   `json:"action,omitempty"`
+	RemindedAt int64                     `json:"reminded_at"`
+}
+
+// deliveredEntry is a delivered notification as saved in the delivered file.
+type deliveredEntry struct {
+	deliveredKey
+	// EndsAt is when the event of the notification ends. Files written by
+	// older versions don't have it, in which case RemindedAt is used.
+	EndsAt int64 `json:"ends_at,omitempty"`
+}
+
+// deliveredStore records the notifications that were delivered, so that they
+// aren't sent again after a restart. It is persisted to a JSON file. It is
+// safe to use from multiple goroutines, so that it can be compacted while
+// notifications are delivered.
+type deliveredStore struct {
+	path      string
+	retention time.Duration
+
+	mu   sync.Mutex
+	keys map[deliveredKey]int64 // to EndsAt
+}
+
+// loadDeliveredStore loads the store from the file at path. A missing file is
+// not an error and yields an empty store. Notifications are kept until their
+// event has ended for longer than retention.
+func loadDeliveredStore(path string, retention time.Duration) (*deliveredStore, error) {
+	s := &deliveredStore{
+		path:      path,
+		retention: retention,
+		keys:      make(map[deliveredKey]int64),
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, errors.Wrap(err, "failed to read delivered file")
+	}
+
+	var entries []deliveredEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.Wrap(err, "failed to decode delivered file")
+	}
+
+	for _, entry := range entries {
+		s.keys[entry.deliveredKey] = entry.EndsAt
+	}
+
+	return s, nil
+}
+
+func newDeliveredKey(calendarURL string, n calendar.Notification) (deliveredKey, bool) {
+	if n.Event.UID == "" {
+		return deliveredKey{}, false
+	}
+	return deliveredKey{
+		Calendar:   calendarURL,
+		UID:        n.Event.UID,
+		Kind:       n.Kind,
+		Action:     n.Action,
+		RemindedAt: n.RemindedAt.Unix(),
+	}, true
+}
+
+// has returns true if the notification was already delivered. Notifications
+// for events without a UID are never considered delivered.
+func (s *deliveredStore) has(calendarURL string, n calendar.Notification) bool {
+	key, ok := newDeliveredKey(calendarURL, n)
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok = s.keys[key]
+	return ok
+}
+
+// record records the notification as delivered and saves the store.
+func (s *deliveredStore) record(calendarURL string, n calendar.Notification) error {
+	key, ok := newDeliveredKey(calendarURL, n)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key] = n.Event.EndsAt.Unix()
+	return s.save()
+}
+
+// size returns the number of recorded notifications.
+func (s *deliveredStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys)
+}
+
+// compact forgets the notifications whose event ended more than the
+// retention before now, and saves the store if any were forgotten. It returns
+// the number of forgotten notifications.
+func (s *deliveredStore) compact(now time.Time) (int, error) {
+	cutoff := now.Add(-s.retention).Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int
+	for k, endsAt := range s.keys {
+		if endsAt < k.RemindedAt {
+			endsAt = k.RemindedAt
+		}
+		if endsAt < cutoff {
+			delete(s.keys, k)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save()
+}
+
+// compactEvery compacts the store immediately and then at every interval
+// until ctx is done.
+func (s *deliveredStore) compactEvery(ctx context.Context, interval time.Duration) error {
+	ticker := clocker.NewTickerContext(ctx, interval)
+	for {
+		removed, err := s.compact(time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx,
+				"failed to compact delivered notifications",
+				"path", s.path,
+				"error", err)
+		} else {
+			slog.DebugContext(ctx,
+				"compacted delivered notifications",
+				"path", s.path,
+				"removed", removed,
+				"size", s.size())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// save writes the store to its file. s.mu must be held.
+func (s *deliveredStore) save() error {
+	entries := make([]deliveredEntry, 0, len(s.keys))
+	for k, endsAt := range s.keys {
+		entries = append(entries, deliveredEntry{k, endsAt})
+	}
+
+	return errors.Wrap(writeJSONFile(s.path, entries), "failed to save delivered notifications")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestDeliveredStore(t *testing.T) {
+	const calendarURL = "https://example.com/calendar.ics"
+
+	path := filepath.Join(t.TempDir(), "delivered.json")
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	store, err := loadDeliveredStore(path, 24*time.Hour)
+	assert.NoError(t, err)
+
+	old := calendar.Notification{
+		Event:      calendar.Event{UID: "old", EndsAt: now.Add(-47 * time.Hour)},
+		RemindedAt: now.Add(-48 * time.Hour),
+	}
+	reminder := calendar.Notification{
+		Event:      calendar.Event{UID: "event", EndsAt: now.Add(time.Hour)},
+		RemindedAt: now,
+	}
+	cancelled := reminder
+	cancelled.Kind = calendar.NotificationCancelled
+	email := reminder
+	email.Action = calendar.ReminderActionEmail
+	noUID := calendar.Notification{RemindedAt: now}
+
+	assert.NoError(t, store.record(calendarURL, old))
+	assert.NoError(t, store.record(calendarURL, reminder))
+	assert.NoError(t, store.record(calendarURL, noUID))
+
+	removed, err := store.compact(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	store, err = loadDeliveredStore(path, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.size())
+
+	assert.True(t, store.has(calendarURL, reminder))
+	assert.False(t, store.has("https://example.com/other.ics", reminder))
+	assert.False(t, store.has(calendarURL, cancelled))
+	assert.False(t, store.has(calendarURL, email), "actions are delivered separately")
+	assert.False(t, store.has(calendarURL, noUID))
+	assert.False(t, store.has(calendarURL, old), "old notifications are forgotten")
+}
+
+func TestDeliveredStore_retention(t *testing.T) {
+	const calendarURL = "https://example.com/calendar.ics"
+
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	store, err := loadDeliveredStore(filepath.Join(t.TempDir(), "delivered.json"), 7*24*time.Hour)
+	assert.NoError(t, err)
+
+	// Reminded about long ago, but the event only ended recently.
+	long := calendar.Notification{
+		Event:      calendar.Event{UID: "long", EndsAt: now.AddDate(0, 0, -6)},
+		RemindedAt: now.AddDate(0, 0, -30),
+	}
+	ended := calendar.Notification{
+		Event:      calendar.Event{UID: "ended", EndsAt: now.AddDate(0, 0, -8)},
+		RemindedAt: now.AddDate(0, 0, -8),
+	}
+	assert.NoError(t, store.record(calendarURL, long))
+	assert.NoError(t, store.record(calendarURL, ended))
+
+	removed, err := store.compact(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.True(t, store.has(calendarURL, long))
+	assert.False(t, store.has(calendarURL, ended))
+
+	removed, err = store.compact(now.AddDate(0, 0, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 0, store.size())
+}
+
+func TestDeliveredStore_concurrentCompact(t *testing.T) {
+	const calendarURL = "https://example.com/calendar.ics"
+
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	store, err := loadDeliveredStore(filepath.Join(t.TempDir(), "delivered.json"), time.Hour)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			n := calendar.Notification{
+				Event:      calendar.Event{UID: fmt.Sprint(i), EndsAt: now},
+				RemindedAt: now,
+			}
+			assert.NoError(t, store.record(calendarURL, n))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, err := store.compact(now)
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 50, store.size())
+}
+
+func TestConfig_deliveredRetention(t *testing.T) {
+	var cfg config
+	assert.Equal(t, 24*time.Hour, cfg.deliveredRetention())
+
+	cfg.Retention = durationValue(7 * 24 * time.Hour)
+	assert.Equal(t, 7*24*time.Hour, cfg.deliveredRetention())
+
+	cfg.Retention = durationValue(time.Hour)
+	assert.Equal(t, 24*time.Hour, cfg.deliveredRetention())
+}
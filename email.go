@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// Destinations of notifications, as used in calendarConfig.Destinations.
+const (
+	destinationWebhook = "webhook"
+	destinationEmail   = "email"
+)
+
+// emailConfig configures sending notifications by email.
+type emailConfig struct {
+	// SMTPAddr is the address of the SMTP server, e.g. "smtp.example.com:587".
+	SMTPAddr string `json:"smtp_addr"`
+	// Username and Password, if set, are used to authenticate to the SMTP
+	// server.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// From is the sender address.
+	From string `json:"from"`
+	// To are the recipient addresses.
+	To []string `json:"to"`
+}
+
+func (c emailConfig) validate() error {
+	if c.SMTPAddr == "" {
+		return errors.New("missing smtp_addr")
+	}
+	if c.From == "" {
+		return errors.New("missing from")
+	}
+	if len(c.To) == 0 {
+		return errors.New("missing to")
+	}
+	return nil
+}
+
+// validateDestinations checks that the calendar's destinations are known and
+// configured.
+func validateDestinations(cfg calendarConfig) error {
+	for action, destination := range cfg.Destinations {
+		switch destination {
+		case destinationWebhook:
+		case destinationEmail:
+			if cfg.Email == nil {
+				return errors.Errorf("action %q is sent by email, but email is not configured", action)
+			}
+		default:
+			return errors.Errorf("unknown destination %q for action %q", destination, action)
+		}
+	}
+	if cfg.Email != nil {
+		if err := cfg.Email.validate(); err != nil {
+			return errors.Wrap(err, "invalid email config")
+		}
+	}
+	return nil
+}
+
+// destination returns where the notification should be delivered. It returns
+// an empty string if the notification's action has no destination, in which
+// case it should be dropped. Notifications without an action, e.g.
+// announcements, always go to the webhook.
+func (c *trackedCalendar) destination(n calendar.Notification) string {
+	return c.actionDestination(n.Action)
+}
+
+// actionDestination returns where the notifications of reminders with the
+// given action are delivered, like destination.
+func (c *trackedCalendar) actionDestination(action calendar.ReminderAction) string {
+	if len(c.Config.Destinations) == 0 || action == "" {
+		return destinationWebhook
+	}
+	return c.Config.Destinations[action]
+}
+
+// createEmailMessage creates the subject and plain text body of the email for
+// the notification.
+func createEmailMessage(cal *trackedCalendar, n calendar.Notification) (subject, body string, err error) {
+	var title strings.Builder
+	if err := cal.EmbedStyles[n.Kind].Title.Execute(&title, n); err != nil {
+		return "", "", errors.Wrap(err, "failed to execute title template")
+	}
+
+	var b strings.Builder
+	b.WriteString(cal.Config.Prefix)
+	if err := cal.MessageTemplate.Execute(&b, n); err != nil {
+		return "", "", errors.Wrap(err, "failed to execute message template")
+	}
+	b.WriteString(cal.Config.Suffix)
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+
+	startsAt := n.Event.StartsAt.In(cal.Location)
+	if n.Event.AllDay {
+		fmt.Fprintf(&b, "Date: %s\n", allDayDate(n.Event))
+	} else {
+		fmt.Fprintf(&b, "Starts: %s\n", startsAt.Format("Monday, January 2, 2006 at 3:04 PM MST"))
+	}
+	if duration := n.Event.EndsAt.Sub(n.Event.StartsAt); duration > 0 {
+		fmt.Fprintf(&b, "Duration: %s\n", humanDuration(duration))
+	}
+	if location := eventLocation(cal, n.Event); location != "" {
+		fmt.Fprintf(&b, "Location: %s\n", location)
+	}
+
+	description := cal.ReminderRe.ReplaceAllString(n.Event.Description, "")
+	if description = strings.TrimSpace(description); description != "" {
+		b.WriteString("\n")
+		b.WriteString(description)
+		b.WriteString("\n")
+	}
+
+	return title.String(), b.String(), nil
+}
+
+// sendEmail sends the notification by email using the calendar's email
+// config. Like webhook requests, it is bounded by the calendar's
+// request_timeout.
+func (c *trackedCalendar) sendEmail(ctx context.Context, n calendar.Notification) error {
+	cfg := c.Config.Email
+	if cfg == nil {
+		return errors.New("email is not configured")
+	}
+
+	subject, body, err := createEmailMessage(c, n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Config.requestTimeout())
+	defer cancel()
+
+	msg := formatEmail(cfg.From, cfg.To, subject, body)
+	if err := sendMail(ctx, *cfg, msg); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+
+	return nil
+}
+
+// sendMail is like smtp.SendMail, but it gives up once ctx is done.
+func sendMail(ctx context.Context, cfg emailConfig, msg []byte) error {
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return errors.Wrap(err, "invalid smtp_addr")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.SMTPAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect")
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return errors.Wrap(err, "failed to start TLS")
+		}
+	}
+
+	if cfg.Username != "" {
+		auth := smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return errors.Wrap(err, "failed to authenticate")
+		}
+	}
+
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// formatEmail formats a plain text email message.
+func formatEmail(from string, to []string, subject, body string) []byte {
+	// Header values must not contain line breaks.
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
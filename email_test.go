@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestTrackedCalendar_destination(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+		Destinations: map[calendar.ReminderAction]string{
+			"DISCORD": destinationWebhook,
+			"EMAIL":   destinationEmail,
+		},
+		Email: &emailConfig{
+			SMTPAddr: "smtp.example.com:587",
+			From:     "reminders@example.com",
+			To:       []string{"me@example.com"},
+		},
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		action calendar.ReminderAction
+		expect string
+	}{
+		{"DISCORD", destinationWebhook},
+		{"EMAIL", destinationEmail},
+		{"AUDIO", ""},
+		{"", destinationWebhook},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.action), func(t *testing.T) {
+			n := calendar.Notification{Action: test.action}
+			assert.Equal(t, test.expect, cal.destination(n))
+		})
+	}
+
+	cal.Config.Destinations = nil
+	assert.Equal(t, destinationWebhook, cal.destination(calendar.Notification{Action: "AUDIO"}))
+}
+
+func TestTrackedCalendar_dedupByDestination(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		ICalURL:    "calendar/test_valarm.ics",
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	_, err = cal.Calendar.Refresh(context.Background())
+	assert.NoError(t, err)
+
+	start := time.Date(2022, time.November, 1, 17, 0, 0, 0, time.UTC)
+	events := cal.EventsBetween(start.Add(-time.Hour), start.Add(time.Hour), calendar.EventsOpts{
+		DefaultReminders:      []time.Duration{15 * time.Minute},
+		DefaultReminderAction: "DISCORD",
+		IncludeVALARM:         true,
+	})
+	assert.Equal(t, 1, len(events))
+
+	// The VALARM DISPLAY reminder and the default DISCORD reminder both go to
+	// the webhook at the same time, so only one of them is kept.
+	var at15 int
+	for _, r := range events[0].Reminders {
+		if r.RemindAt.Equal(start.Add(-15 * time.Minute)) {
+			at15++
+		}
+	}
+	assert.Equal(t, 1, at15)
+}
+
+func TestValidateDestinations(t *testing.T) {
+	email := &emailConfig{
+		SMTPAddr: "smtp.example.com:587",
+		From:     "reminders@example.com",
+		To:       []string{"me@example.com"},
+	}
+
+	tests := []struct {
+		name   string
+		cfg    calendarConfig
+		expect string
+	}{
+		{
+			"valid",
+			calendarConfig{
+				Destinations: map[calendar.ReminderAction]string{"EMAIL": destinationEmail},
+				Email:        email,
+			},
+			"",
+		},
+		{
+			"unknown",
+			calendarConfig{
+				Destinations: map[calendar.ReminderAction]string{"EMAIL": "pigeon"},
+			},
+			"unknown destination",
+		},
+		{
+			"missing_email",
+			calendarConfig{
+				Destinations: map[calendar.ReminderAction]string{"EMAIL": destinationEmail},
+			},
+			"email is not configured",
+		},
+		{
+			"invalid_email",
+			calendarConfig{
+				Email: &emailConfig{SMTPAddr: "smtp.example.com:587"},
+			},
+			"missing from",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateDestinations(test.cfg)
+			if test.expect == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), test.expect)
+			}
+		})
+	}
+}
+
+func TestCreateEmailMessage(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:      testWebhookURL,
+		MessageTemplate: "Don't forget!",
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	subject, body, err := createEmailMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			Summary:     "Meeting",
+			Location:    "Room 1",
+			Description: "Bring snacks.\nRemind on Discord 1 hour before the event.",
+			StartsAt:    startsAt,
+			EndsAt:      startsAt.Add(time.Hour),
+		},
+		Action: "EMAIL",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Meeting", subject)
+	assert.Equal(t, strings.Join([]string{
+		"Don't forget!",
+		"",
+		"Starts: Tuesday, August 1, 2023 at 5:00 PM UTC",
+		"Duration: 1 hour",
+		"Location: Room 1",
+		"",
+		"Bring snacks.",
+		"",
+	}, "\n"), body)
+}
+
+func TestFormatEmail(t *testing.T) {
+	msg := formatEmail(
+		"reminders@example.com",
+		[]string{"a@example.com", "b@example.com"},
+		"Meeting\nwith\r\ninjection",
+		"Hello\nWorld")
+
+	assert.Equal(t, ""+
+		"From: reminders@example.com\r\n"+
+		"To: a@example.com, b@example.com\r\n"+
+		"Subject: Meeting with injection\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"\r\n"+
+		"Hello\r\nWorld", string(msg))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// embedStyleConfig configures how the embed of a notification looks.
+type embedStyleConfig struct {
+	// Color is the embed's color, e.g. "#2c91c6".
+	Color colorValue `json:"color"`
+	// Title is a template for the embed's title. It is executed against
+	// the notification.
+	Title string `json:"title"`
+	// Label, if not empty, is shown as the Status field of the embed.
+	Label string `json:"label"`
+}
+
+// embedConfig configures the embeds of a calendar's notifications.
+type embedConfig struct {
+	// Color, if set, is the color of reminder embeds, e.g. "#2c91c6". The
+	// other notification kinds keep their own colors, and embed_styles takes
+	// precedence.
+	Color colorValue `json:"color"`
+	// Fields toggles the built-in fields of the embed by name, e.g.
+	// {"duration": false}. Fields that are not listed are shown.
+	Fields map[string]bool `json:"fields"`
+	// HideAllDayDuration, if true, hides the duration of all-day events.
+	HideAllDayDuration bool `json:"hide_all_day_duration"`
+}
+
+// embedFields are the names of the built-in embed fields that can be toggled.
+var embedFields = []string{"start_time", "duration", "repeats", "status", "location"}
+
+// showField returns whether the built-in field with the given name is shown.
+func (c embedConfig) showField(name string) bool {
+	show, ok := c.Fields[name]
+	return !ok || show
+}
+
+func (c embedConfig) validate() error {
+	for name := range c.Fields {
+		if !slices.Contains(embedFields, name) {
+			return errors.Errorf("unknown field %q, must be one of %s", name, strings.Join(embedFields, ", "))
+		}
+	}
+	return nil
+}
+
+// embedStyleKinds maps the keys of the embed_styles config to notification
+// kinds.
+var embedStyleKinds = map[string]calendar.NotificationKind{
+	"reminder":  calendar.NotificationReminder,
+	"updated":   calendar.NotificationUpdated,
+	"cancelled": calendar.NotificationCancelled,
+	"announced": calendar.NotificationAnnounced,
+}
+
+var defaultEmbedStyles = map[calendar.NotificationKind]embedStyleConfig{
+	calendar.NotificationReminder: {
+		Color: 0x2c91c6,
+		Title: "{{.Event.Summary}}",
+	},
+	calendar.NotificationUpdated: {
+		Color: 0xe8a33d,
+		Title: "Rescheduled: {{.Event.Summary}}",
+		Label: "UPDATED",
+	},
+	calendar.NotificationCancelled: {
+		Color: 0xd9534f,
+		Title: "~~{{.Event.Summary}}~~",
+		Label: "CANCELLED",
+	},
+	calendar.NotificationAnnounced: {
+		Color: 0x5cb85c,
+		Title: "New: {{.Event.Summary}}",
+		Label: "NEW",
+	},
+}
+
+type embedStyle struct {
+	Color discord.Color
+	Title *template.Template
+	Label string
+}
+
+// newEmbedStyles creates the embed styles for each notification kind, using
+// the given overrides on top of the defaults. If color is non-zero, it
+// replaces the default color of reminders.
+func newEmbedStyles(color colorValue, overrides map[string]embedStyleConfig) (map[calendar.NotificationKind]embedStyle, error) {
+	configs := make(map[calendar.NotificationKind]embedStyleConfig, len(defaultEmbedStyles))
+	for kind, style := range defaultEmbedStyles {
+		configs[kind] = style
+	}
+
+	if color != 0 {
+		style := configs[calendar.NotificationReminder]
+		style.Color = color
+		configs[calendar.NotificationReminder] = style
+	}
+
+	for name, override := range overrides {
+		kind, ok := embedStyleKinds[name]
+		if !ok {
+			return nil, errors.Errorf("unknown embed style %q", name)
+		}
+
+		style := configs[kind]
+		if override.Color != 0 {
+			style.Color = override.Color
+		}
+		if override.Title != "" {
+			style.Title = override.Title
+		}
+		if override.Label != "" {
+			style.Label = override.Label
+		}
+		configs[kind] = style
+	}
+
+	styles := make(map[calendar.NotificationKind]embedStyle, len(configs))
+	for kind, config := range configs {
+		title, err := template.New("").Parse(config.Title)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse title template for %q embeds", kind)
+		}
+		styles[kind] = embedStyle{
+			Color: discord.Color(config.Color),
+			Title: title,
+			Label: config.Label,
+		}
+	}
+
+	return styles, nil
+}
+
+// renderTitle renders the embed title for the given notification.
+func (s embedStyle) renderTitle(notification calendar.Notification) (string, error) {
+	var title strings.Builder
+	if err := s.Title.Execute(&title, notification); err != nil {
+		return "", errors.Wrap(err, "failed to execute title template")
+	}
+	return title.String(), nil
+}
+
+// Discord's hard limits on embeds, in bytes as counted by arikawa.
+const (
+	maxEmbedTitle       = 256
+	maxEmbedDescription = 4096
+	maxEmbedFooter      = 2048
+	maxEmbedFieldName   = 256
+	maxEmbedFieldValue  = 1024
+	maxEmbedTotal       = 6000
+)
+
+// embedLimits are configurable caps on the size of an embed. Zero values and
+// values above Discord's limits fall back to Discord's limits.
+type embedLimits struct {
+	MaxFields      int
+	MaxDescription int
+}
+
+func (l embedLimits) maxFields() int {
+	if l.MaxFields <= 0 || l.MaxFields > maxEmbedFields {
+		return maxEmbedFields
+	}
+	return l.MaxFields
+}
+
+func (l embedLimits) maxDescription() int {
+	if l.MaxDescription <= 0 || l.MaxDescription > maxEmbedDescription {
+		return maxEmbedDescription
+	}
+	return l.MaxDescription
+}
+
+// capEmbed truncates and drops parts of the embed so that it stays within the
+// given limits and Discord's hard limits. Excess fields are dropped, with a
+// note in the footer.
+func capEmbed(embed *discord.Embed, limits embedLimits) {
+	embed.Title = truncateText(embed.Title, maxEmbedTitle)
+	embed.Description = truncateText(embed.Description, limits.maxDescription())
+
+	for i, field := range embed.Fields {
+		embed.Fields[i].Name = truncateText(field.Name, maxEmbedFieldName)
+		embed.Fields[i].Value = truncateText(field.Value, maxEmbedFieldValue)
+	}
+
+	var dropped int
+	if maxFields := limits.maxFields(); len(embed.Fields) > maxFields {
+		dropped = len(embed.Fields) - maxFields
+		embed.Fields = embed.Fields[:maxFields]
+	}
+
+	// Make room for the footer note before checking the total length.
+	if dropped > 0 {
+		note := fmt.Sprintf("%d more fields omitted", dropped)
+		if embed.Footer == nil {
+			embed.Footer = &discord.EmbedFooter{Text: note}
+		} else {
+			embed.Footer.Text += " · " + note
+		}
+	}
+
+	if embed.Footer != nil {
+		embed.Footer.Text = truncateText(embed.Footer.Text, maxEmbedFooter)
+	}
+
+	// Shrink the description first, since it's usually the longest part, then
+	// drop fields from the end.
+	if excess := embed.Length() - maxEmbedTotal; excess > 0 {
+		n := len(embed.Description) - excess
+		if n < 0 {
+			n = 0
+		}
+		embed.Description = truncateText(embed.Description, n)
+	}
+	for embed.Length() > maxEmbedTotal && len(embed.Fields) > 0 {
+		embed.Fields = embed.Fields[:len(embed.Fields)-1]
+	}
+}
+
+const ellipsis = "…"
+
+// truncateText truncates s to at most n bytes without splitting a rune,
+// marking the truncation with an ellipsis.
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n < len(ellipsis) {
+		return ""
+	}
+
+	cut := n - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestTruncateText(t *testing.T) {
+	assert.Equal(t, "hello", truncateText("hello", 5))
+	assert.Equal(t, "he…", truncateText("hello world", 5))
+	assert.Equal(t, "", truncateText("hello", 1))
+
+	// Multi-byte runes must not be split.
+	s := truncateText(strings.Repeat("é", 10), 8)
+	assert.True(t, utf8.ValidString(s))
+	assert.True(t, len(s) <= 8)
+}
+
+func TestCapEmbed(t *testing.T) {
+	t.Run("at_limits", func(t *testing.T) {
+		embed := discord.Embed{
+			Title:       strings.Repeat("t", maxEmbedTitle),
+			Description: strings.Repeat("d", 1000),
+			Fields:      makeEmbedFields(maxEmbedFields, 10),
+		}
+		expect := embed
+		expect.Fields = append([]discord.EmbedField(nil), embed.Fields...)
+
+		capEmbed(&embed, embedLimits{})
+		assert.Equal(t, expect, embed)
+		assert.NoError(t, embed.Validate())
+	})
+
+	t.Run("too_many_fields", func(t *testing.T) {
+		embed := discord.Embed{
+			Title:  "title",
+			Fields: makeEmbedFields(maxEmbedFields+5, 10),
+		}
+
+		capEmbed(&embed, embedLimits{})
+		assert.Equal(t, maxEmbedFields, len(embed.Fields))
+		assert.Equal(t, "5 more fields omitted", embed.Footer.Text)
+		assert.NoError(t, embed.Validate())
+	})
+
+	t.Run("configured_limits", func(t *testing.T) {
+		embed := discord.Embed{
+			Title:       "title",
+			Description: strings.Repeat("d", 100),
+			Fields:      makeEmbedFields(5, 10),
+		}
+
+		capEmbed(&embed, embedLimits{MaxFields: 3, MaxDescription: 50})
+		assert.Equal(t, 3, len(embed.Fields))
+		assert.Equal(t, 50, len(embed.Description))
+	})
+
+	t.Run("too_long", func(t *testing.T) {
+		embed := discord.Embed{
+			Title:       strings.Repeat("t", maxEmbedTitle+10),
+			Description: strings.Repeat("d", maxEmbedDescription+10),
+			Fields:      makeEmbedFields(maxEmbedFields, maxEmbedFieldValue+10),
+		}
+
+		capEmbed(&embed, embedLimits{})
+		assert.True(t, embed.Length() <= maxEmbedTotal)
+		assert.NoError(t, embed.Validate())
+	})
+}
+
+func makeEmbedFields(n, valueLen int) []discord.EmbedField {
+	fields := make([]discord.EmbedField, n)
+	for i := range fields {
+		fields[i] = discord.EmbedField{
+			Name:  fmt.Sprintf("field %d", i),
+			Value: strings.Repeat("v", valueLen),
+		}
+	}
+	return fields
+}
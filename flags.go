@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+	"github.com/pkg/errors"
+)
+
+// executeData extends webhook.ExecuteData with message flags, which the
+// webhook package doesn't support yet.
+type executeData struct {
+	webhook.ExecuteData
+	Flags discord.MessageFlags `json:"flags,omitempty"`
+}
+
+// executeWithFlags is like webhook.Client.Execute, but also sends the given
+// message flags. If wait is true, the created message is returned. The embeds
+// are capped to Discord's limits first.
+func executeWithFlags(c *webhook.Client, data webhook.ExecuteData, flags discord.MessageFlags, wait bool) (*discord.Message, error) {
+	data.Embeds = slices.Clone(data.Embeds)
+	for i := range data.Embeds {
+		capEmbed(&data.Embeds[i], embedLimits{})
+	}
+
+	if flags == 0 {
+		if wait {
+			return c.ExecuteAndWait(data)
+		}
+		return nil, c.Execute(data)
+	}
+
+	// Validate the message like webhook.Client.Execute does.
+	if data.Content == "" && len(data.Embeds) == 0 && len(data.Files) == 0 {
+		return nil, api.ErrEmptyMessage
+	}
+	if data.AllowedMentions != nil {
+		if err := data.AllowedMentions.Verify(); err != nil {
+			return nil, errors.Wrap(err, "allowedMentions error")
+		}
+	}
+	var sum int
+	for i, embed := range data.Embeds {
+		if err := embed.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "embed error at %d", i)
+		}
+		sum += embed.Length()
+		if sum > maxEmbedTotal {
+			return nil, &discord.OverboundError{Count: sum, Max: maxEmbedTotal, Thing: "sum of all text in embeds"}
+		}
+	}
+
+	param := make(url.Values, 2)
+	if wait {
+		param.Set("wait", "true")
+	}
+	if data.ThreadID.IsValid() {
+		param.Set("thread_id", data.ThreadID.String())
+	}
+
+	u := api.EndpointWebhooks + c.ID.String() + "/" + c.Token + "?" + param.Encode()
+
+	var msg *discord.Message
+	var ptr interface{}
+	if wait {
+		ptr = &msg
+	}
+
+	return msg, sendpart.POST(c.Client, executeData{data, flags}, ptr, u)
+}
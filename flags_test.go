@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestTrackedCalendar_messageFlags(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:    testWebhookURL,
+		SilentActions: []calendar.ReminderAction{calendar.ReminderActionDisplay},
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		action calendar.ReminderAction
+		expect discord.MessageFlags
+	}{
+		{calendar.ReminderActionDisplay, discord.SuppressNotifications},
+		{calendar.ReminderActionAudio, 0},
+		{"DISCORD", 0},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		flags := cal.messageFlags(calendar.Notification{Action: test.action})
+		assert.Equal(t, test.expect, flags, "action %q", test.action)
+	}
+}
+
+func TestTrackedCalendar_messageFlagsDefault(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	display := calendar.Notification{Action: calendar.ReminderActionDisplay}
+	audio := calendar.Notification{Action: calendar.ReminderActionAudio}
+	discordAction := calendar.Notification{Action: "DISCORD"}
+
+	assert.Equal(t, discord.SuppressNotifications, cal.messageFlags(display))
+	assert.Equal(t, 0, cal.messageFlags(audio))
+	assert.Equal(t, 0, cal.messageFlags(discordAction))
+
+	// An empty list pings for every action.
+	var cfg calendarConfig
+	assert.NoError(t, json.Unmarshal([]byte(`{"silent_actions": []}`), &cfg))
+	cal.Config.SilentActions = cfg.SilentActions
+	assert.Equal(t, 0, cal.messageFlags(display))
+}
+
+func TestExecuteData_flags(t *testing.T) {
+	b, err := json.Marshal(executeData{
+		ExecuteData: webhook.ExecuteData{Content: "hello"},
+		Flags:       discord.SuppressNotifications,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"content":"hello","flags":4096}`, string(b))
+}
+
+func TestExecuteWithFlags_capsEmbeds(t *testing.T) {
+	var sent executeData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	endpoint := api.EndpointWebhooks
+	api.EndpointWebhooks = server.URL + "/api/webhooks/"
+	defer func() { api.EndpointWebhooks = endpoint }()
+
+	c, err := webhook.NewFromURL(testWebhookURL)
+	assert.NoError(t, err)
+
+	data := webhook.ExecuteData{
+		Embeds: []discord.Embed{{
+			Title:       strings.Repeat("t", 1000),
+			Description: strings.Repeat("d", 10000),
+		}},
+	}
+
+	_, err = executeWithFlags(c, data, discord.SuppressNotifications, false)
+	assert.NoError(t, err)
+	assert.Equal(t, discord.SuppressNotifications, sent.Flags)
+	assert.Equal(t, 1, len(sent.Embeds))
+	assert.True(t, len(sent.Embeds[0].Title) <= maxEmbedTitle)
+	assert.True(t, len(sent.Embeds[0].Description) <= maxEmbedDescription)
+
+	// The caller's embeds are left alone.
+	assert.Equal(t, 10000, len(data.Embeds[0].Description))
+}
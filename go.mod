@@ -1,6 +1,6 @@
 module libdb.so/discord-ical-reminder
 
-go 1.20
+go 1.21
 
 require (
 	github.com/alecthomas/assert/v2 v2.3.0
@@ -8,6 +8,7 @@ require (
 	github.com/emersion/go-ical v0.0.0-20220601085725-0864dccc089f
 	github.com/hako/durafmt v0.0.0-20210608085754-5c1018a4e16b
 	github.com/pkg/errors v0.9.1
+	github.com/teambition/rrule-go v1.7.2
 	github.com/tj/go-naturaldate v1.3.0
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
 )
@@ -17,5 +18,4 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gorilla/schema v1.2.0 // indirect
 	github.com/hexops/gotextdiff v1.0.3 // indirect
-	github.com/teambition/rrule-go v1.7.2 // indirect
 )
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// healthHandler serves the /healthz, /readyz and /metrics endpoints.
+//
+// /healthz always succeeds while the process is running. /readyz succeeds
+// once every calendar has been loaded and its last refresh succeeded within
+// twice the refresh frequency. /metrics reports the size of the delivered
+// store in the Prometheus text format.
+type healthHandler struct {
+	mux              *http.ServeMux
+	refreshFrequency time.Duration
+	now              func() time.Time
+	// delivered is the delivered store, or nil if there is none. It must be
+	// set before serving.
+	delivered *deliveredStore
+
+	mu        sync.Mutex
+	calendars []*trackedCalendar
+}
+
+func newHealthHandler(refreshFrequency time.Duration) *healthHandler {
+	h := &healthHandler{
+		mux:              http.NewServeMux(),
+		refreshFrequency: refreshFrequency,
+		now:              time.Now,
+	}
+	h.mux.HandleFunc("/healthz", h.healthz)
+	h.mux.HandleFunc("/readyz", h.readyz)
+	h.mux.HandleFunc("/metrics", h.metrics)
+	return h
+}
+
+// setCalendars sets the calendars that readiness is checked against.
+func (h *healthHandler) setCalendars(calendars []*trackedCalendar) {
+	h.mu.Lock()
+	h.calendars = calendars
+	h.mu.Unlock()
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *healthHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+func (h *healthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	problems := h.notReady()
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, strings.Join(problems, "\n")+"\n")
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func (h *healthHandler) metrics(w http.ResponseWriter, r *http.Request) {
+	var size int
+	if h.delivered != nil {
+		size = h.delivered.size()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP discord_ical_reminder_delivered_notifications Number of notifications in the delivered file.")
+	fmt.Fprintln(w, "# TYPE discord_ical_reminder_delivered_notifications gauge")
+	fmt.Fprintln(w, "discord_ical_reminder_delivered_notifications", size)
+}
+
+// notReady returns the reasons why the calendars are not ready, if any.
+func (h *healthHandler) notReady() []string {
+	h.mu.Lock()
+	calendars := h.calendars
+	h.mu.Unlock()
+
+	now := h.now()
+
+	var problems []string
+	for _, cal := range calendars {
+		lastRefresh, err := cal.Calendar.LastRefresh()
+		switch {
+		case lastRefresh.IsZero():
+			problems = append(problems, fmt.Sprintf("%s: not loaded yet", cal.Config.ICalURL))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: last refresh failed: %v", cal.Config.ICalURL, err))
+		case h.refreshFrequency > 0 && now.Sub(lastRefresh) > 2*h.refreshFrequency:
+			problems = append(problems, fmt.Sprintf("%s: not refreshed since %s",
+				cal.Config.ICalURL, lastRefresh.Format(time.RFC3339)))
+		}
+	}
+	return problems
+}
+
+// serveHTTP serves handler on addr until ctx is done.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for HTTP")
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	defer stop()
+
+	slog.InfoContext(ctx,
+		"serving health endpoints",
+		"addr", l.Addr().String())
+
+	if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "failed to serve HTTP")
+	}
+	return nil
+}
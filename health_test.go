@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestHealthHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	assert.NoError(t, os.WriteFile(path, []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), 0o644))
+
+	cal := &trackedCalendar{
+		Calendar: calendar.NewOnlineICSCalendar(path, nil),
+		Config:   calendarConfig{ICalURL: path},
+	}
+
+	health := newHealthHandler(time.Minute)
+	health.setCalendars([]*trackedCalendar{cal})
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		body, _ := io.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	code, _ := get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "not loaded yet")
+
+	_, err := cal.Calendar.Refresh(context.Background())
+	assert.NoError(t, err)
+
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	health.now = func() time.Time { return time.Now().Add(3 * time.Minute) }
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "not refreshed since")
+
+	health.now = time.Now
+	assert.NoError(t, os.Remove(path))
+	_, err = cal.Calendar.Refresh(context.Background())
+	assert.Error(t, err)
+
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "last refresh failed")
+}
+
+func TestHealthHandler_metrics(t *testing.T) {
+	delivered, err := loadDeliveredStore(filepath.Join(t.TempDir(), "delivered.json"), time.Hour)
+	assert.NoError(t, err)
+
+	n := calendar.Notification{
+		Event:      calendar.Event{UID: "event", EndsAt: time.Now()},
+		RemindedAt: time.Now(),
+	}
+	assert.NoError(t, delivered.record("https://example.com/calendar.ics", n))
+
+	health := newHealthHandler(time.Minute)
+	health.delivered = delivered
+
+	w := httptest.NewRecorder()
+	health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "discord_ical_reminder_delivered_notifications 1\n")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// runList implements the list command, which prints the events of all
+// calendars within a range of days starting today, or -from days from today.
+func runList(ctx context.Context, cfg *config, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	days := fs.Int("days", 7, "number of days to list")
+	from := fs.Int("from", 0, "first day to list, relative to today, e.g. -7 for a week ago")
+	past := fs.Bool("past", false, "include events that have already started")
+	fs.Parse(args)
+
+	location := cfg.Timezone.Location()
+	now := time.Now().In(location)
+	start, end := listRange(now, *from, *days)
+
+	type listedEvent struct {
+		calendar.Event
+		Calendar string
+	}
+
+	var events []listedEvent
+	for _, calCfg := range cfg.Calendars {
+		cal := calCfg.onlineCalendar()
+		if _, err := cal.RefreshWithRetry(ctx, calendar.RetryOpts{}); err != nil {
+			slog.ErrorContext(ctx,
+				"failed to refresh calendar",
+				"calendar", calCfg.ICalURL,
+				"error", err)
+			continue
+		}
+
+		calLocation := calCfg.location(location)
+		calStart, calEnd := start.In(calLocation), end.In(calLocation)
+
+		for _, event := range cal.EventsBetween(calStart, calEnd, calendar.EventsOpts{ExcludeCancelled: true}) {
+			if !*past && event.StartsAt.Before(now) {
+				continue
+			}
+			events = append(events, listedEvent{event, calCfg.ICalURL})
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b listedEvent) int {
+		return calendar.CompareEvent(a.Event, b.Event)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tEND\tSUMMARY\tLOCATION\tCALENDAR")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			event.StartsAt.Format("Mon Jan 2 15:04"),
+			event.EndsAt.Format("Mon Jan 2 15:04"),
+			event.Summary,
+			event.Location,
+			event.Calendar)
+	}
+	return w.Flush()
+}
+
+// listRange returns the range of days to list, which starts at midnight from
+// days after now's day and spans the given number of days.
+func listRange(now time.Time, from, days int) (start, end time.Time) {
+	y, m, d := now.Date()
+	start = time.Date(y, m, d+from, 0, 0, 0, 0, now.Location())
+	end = start.AddDate(0, 0, days)
+	return start, end
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestListRange(t *testing.T) {
+	now := time.Date(2023, time.March, 1, 15, 4, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		from, days int
+		start, end time.Time
+	}{
+		{
+			name:  "today",
+			from:  0,
+			days:  7,
+			start: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2023, time.March, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "past_week",
+			from:  -7,
+			days:  7,
+			start: time.Date(2023, time.February, 22, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := listRange(now, test.from, test.days)
+			assert.Equal(t, test.start, start)
+			assert.Equal(t, test.end, end)
+		})
+	}
+}
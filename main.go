@@ -1,19 +1,27 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
 	"time"
+	_ "time/tzdata" // in case the system has no timezone database
 
 	"github.com/diamondburned/arikawa/v3/api/webhook"
 	"github.com/diamondburned/arikawa/v3/discord"
@@ -26,13 +34,17 @@ import (
 )
 
 var (
-	verbose    = false
-	configGlob = "config*.json"
+	verbose     = false
+	configGlob  = "config*.json"
+	preview     = 0
+	previewDays = 7
 )
 
 func init() {
 	flag.BoolVar(&verbose, "v", verbose, "verbose")
 	flag.StringVar(&configGlob, "c", configGlob, "config file")
+	flag.IntVar(&preview, "preview", preview, "print the next N reminders and exit without posting them")
+	flag.IntVar(&previewDays, "preview-days", previewDays, "number of days to look ahead for -preview")
 }
 
 func main() {
@@ -56,10 +68,12 @@ func main() {
 	}
 }
 
-func run(ctx context.Context) error {
+// loadConfig loads the config from the files matching configGlob, including
+// the calendars of its calendar sources.
+func loadConfig(ctx context.Context) (*config, error) {
 	configFiles, err := filepath.Glob(configGlob)
 	if err != nil {
-		return errors.Wrap(err, "failed to glob config files")
+		return nil, errors.Wrap(err, "failed to glob config files")
 	}
 
 	for _, path := range configFiles {
@@ -70,16 +84,61 @@ func run(ctx context.Context) error {
 
 	cfg, err := parseConfigFiles(configFiles)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse config file")
+		return nil, errors.Wrap(err, "failed to parse config file")
 	}
 
-	calendars := make([]*trackedCalendar, len(cfg.Calendars))
-	for i, cfg := range cfg.Calendars {
-		calendar, err := newTrackedCalendar(cfg)
+	if err := loadCalendarSources(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func run(ctx context.Context) error {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if flag.Arg(0) == "list" {
+		return runList(ctx, cfg, flag.Args()[1:])
+	}
+
+	location := cfg.Timezone.Location()
+
+	calendars, err := newTrackedCalendars(ctx, cfg, location, nil)
+	if err != nil {
+		return err
+	}
+
+	order, err := notificationOrder(cfg.NotificationOrder)
+	if err != nil {
+		return err
+	}
+
+	defaultRemindersMode, err := parseDefaultRemindersMode(cfg.DefaultRemindersMode)
+	if err != nil {
+		return err
+	}
+
+	var state runState
+	if cfg.StateFile != "" {
+		state, err = loadRunState(cfg.StateFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var delivered *deliveredStore
+	if cfg.DeliveredFile != "" {
+		delivered, err = loadDeliveredStore(cfg.DeliveredFile, cfg.deliveredRetention())
 		if err != nil {
-			return errors.Wrapf(err, "failed to create calendar %q", cfg.ICalURL)
+			return err
 		}
-		calendars[i] = calendar
 	}
 
 	errg, ctx := errgroup.WithContext(ctx)
@@ -87,31 +146,50 @@ func run(ctx context.Context) error {
 
 	var refreshCh <-chan time.Time
 	if cfg.RefreshFrequency > 0 {
-		refreshCh = clocker.Tick(cfg.RefreshFrequency.Duration())
+		refreshCh = clocker.NewTickerContext(ctx, cfg.RefreshFrequency.Duration()).C
+	}
+
+	eventsOpts := calendar.EventsOpts{
+		DefaultReminderAction: "DISCORD",
+		DefaultReminders:      durationValues(cfg.EventNotifications),
+		DefaultRemindersMode:  defaultRemindersMode,
+		ExcludeCancelled:      !cfg.RemindIfUpdated, // to detect cancellations
+		OnlyNearestReminder:   cfg.OnlyNearestReminder,
+		IncludeVALARM:         cfg.IncludeVALARM,
+		MinDuration:           cfg.MinEventDuration.Duration(),
+		MaxDuration:           cfg.MaxEventDuration.Duration(),
 	}
 
 	notifier := calendar.NewNotifier(calendar.NotifierOpts{
-		EventsOpts: calendar.EventsOpts{
-			DefaultReminderAction: "DISCORD",
-			DefaultReminders:      durationValues(cfg.EventNotifications),
-			ExcludeCancelled:      true,
-			ParseReminder:         newDiscordRemindersParser(ctx),
-		},
-		SkipPastNotifications: true,
+		EventsOpts:              eventsOpts,
+		Location:                location,
+		SkipPastNotifications:   cfg.PastGrace == 0,
+		PastGrace:               cfg.PastGrace.Duration(),
+		DeliverTimeout:          cfg.DeliverTimeout.Duration(),
+		ReplaySince:             replaySince(state.LastProcessed, time.Now(), cfg.replayMaxAge()),
+		CollapseOnFirstSighting: cfg.CollapseOnFirstSighting,
+		LookaheadWindow:         cfg.LookaheadWindow.Duration(),
+		RemindIfUpdated:         cfg.RemindIfUpdated,
+		AnnounceNewEvents:       cfg.AnnounceNewEvents,
+		AnnounceWindow:          cfg.AnnounceWindow.Duration(),
+		Retention:               cfg.Retention.Duration(),
+		BatchWindow:             cfg.BatchWindow.Duration(),
+		Order:                   order,
 	})
-	notifier.Update(func(state *calendar.NotifierState) {
+	updateCalendars := func(state *calendar.NotifierState) {
+		for cal := range state.Calendars {
+			state.RemoveCalendar(cal)
+		}
 		for _, calendar := range calendars {
-			state.AddCalendar(calendar.Calendar)
+			state.AddCalendarIn(calendar, calendar.Location)
 		}
-	})
-
-	notification := make(chan calendar.Notification)
-	errg.Go(func() error { return notifier.Notify(ctx, notification) })
+	}
+	notifier.Update(updateCalendars)
 
-	refreshCalendar := func(ctx context.Context) {
+	refreshCalendars := func(ctx context.Context, calendars []*trackedCalendar) {
 		var changed bool
 		for _, cal := range calendars {
-			u, err := cal.Calendar.Refresh(ctx)
+			u, err := cal.Calendar.RefreshWithRetry(ctx, calendar.RetryOpts{})
 			if err != nil {
 				slog.ErrorContext(ctx,
 					"failed to refresh calendar",
@@ -131,6 +209,45 @@ func run(ctx context.Context) error {
 		}
 	}
 
+	// Fetch the calendars before the notifier starts, so that it sees the
+	// existing events on its first refresh. This matters for
+	// announce_new_events, which would otherwise announce all of them.
+	refreshCalendars(ctx, calendars)
+
+	if preview > 0 {
+		now := time.Now()
+		notifications := notifier.UpcomingEvents(now, now.AddDate(0, 0, previewDays))
+		return printPreview(os.Stdout, notifications, preview, now, location)
+	}
+
+	if delivered != nil {
+		errg.Go(func() error { return delivered.compactEvery(ctx, deliveredCompactInterval) })
+	}
+
+	var health *healthHandler
+	if cfg.HTTPAddr != "" {
+		health = newHealthHandler(cfg.RefreshFrequency.Duration())
+		health.setCalendars(calendars)
+		health.delivered = delivered
+		errg.Go(func() error { return serveHTTP(ctx, cfg.HTTPAddr, health) })
+	}
+
+	notification := make(chan calendar.Notification)
+	errg.Go(func() error { return notifier.Notify(ctx, notification) })
+
+	recordDelivered := func(ctx context.Context, cal *trackedCalendar, notification calendar.Notification) {
+		if delivered == nil {
+			return
+		}
+
+		if err := delivered.record(cal.Config.ICalURL, notification); err != nil {
+			slog.ErrorContext(ctx,
+				"failed to record delivered notification",
+				"path", cfg.DeliveredFile,
+				"error", err)
+		}
+	}
+
 	sendNotification := func(ctx context.Context, notification calendar.Notification) {
 		calendar := findCalendar(calendars, notification.Calendar)
 		if calendar == nil {
@@ -140,6 +257,37 @@ func run(ctx context.Context) error {
 			return
 		}
 
+		if delivered != nil && delivered.has(calendar.Config.ICalURL, notification) {
+			slog.DebugContext(ctx,
+				"drop already delivered notification",
+				"calendar", notification.Calendar,
+				"event", notification.Event.Summary,
+				"reminded_at", notification.RemindedAt)
+			return
+		}
+
+		switch calendar.destination(notification) {
+		case destinationWebhook:
+		case destinationEmail:
+			if err := calendar.sendEmail(ctx, notification); err != nil {
+				slog.ErrorContext(ctx,
+					"failed to send notification by email",
+					"calendar", notification.Calendar,
+					"error", err)
+				state.failed(notification.RemindedAt)
+				return
+			}
+			recordDelivered(ctx, calendar, notification)
+			return
+		default:
+			slog.InfoContext(ctx,
+				"no destination for reminder action, dropping notification",
+				"calendar", notification.Calendar,
+				"event", notification.Event.Summary,
+				"action", notification.Action)
+			return
+		}
+
 		message, err := createNotificationMessage(calendar, notification)
 		if err != nil {
 			slog.ErrorContext(ctx,
@@ -149,24 +297,292 @@ func run(ctx context.Context) error {
 			return
 		}
 
+		// Don't cut off the send if we're shutting down midway through.
+		detachedCtx, cancel := detachContext(ctx, shutdownTimeout)
+		defer cancel()
+
 		// Calculate an expiration time for the context, since the notification
 		// is invalid once the event starts.
 		expireAfter := notification.Event.StartsAt.Sub(notification.RemindedAt)
-		ctx, cancel := context.WithTimeout(ctx, expireAfter)
+		sendCtx, cancel := context.WithTimeout(detachedCtx, expireAfter)
 		defer cancel()
 
-		webhookClient := calendar.WebhookClient.WithContext(ctx)
-		if err := webhookClient.Execute(*message); err != nil {
+		updated, err := calendar.updateCancelled(sendCtx, notification, message)
+		if err != nil {
 			slog.ErrorContext(ctx,
+				"failed to update messages of cancelled event",
+				"calendar", notification.Calendar,
+				"error", err)
+			state.failed(notification.RemindedAt)
+		}
+		if updated {
+			if err == nil {
+				recordDelivered(ctx, calendar, notification)
+			}
+			return
+		}
+
+		if countdown := calendar.Config.LiveCountdown.Duration(); countdown > 0 && expireAfter <= countdown {
+			content := message.Content
+			message.Content = countdownContent(content, expireAfter)
+
+			var m *discord.Message
+			err := calendar.withWebhook(sendCtx, func(c *webhook.Client) (err error) {
+				m, err = executeWithFlags(c, *message, calendar.messageFlags(notification), true)
+				return
+			})
+			if err != nil {
+				logSendFailure(ctx, sendCtx, err,
+					"failed to send notification",
+					"calendar", notification.Calendar,
+					"thread_id", calendar.Config.ThreadID)
+				state.failed(notification.RemindedAt)
+				return
+			}
+
+			recordDelivered(ctx, calendar, notification)
+			calendar.LastNotification = notification
+			calendar.LastMessage = message
+			if calendar.tracksSent() {
+				calendar.recordSent(notification, m.ID, time.Now())
+			}
+
+			errg.Go(func() error {
+				runLiveCountdown(ctx, calendar, m.ID, content, notification.Event.StartsAt)
+				return nil
+			})
+			return
+		}
+
+		m, err := calendar.executeNotification(sendCtx, notification, *message)
+		if err != nil {
+			logSendFailure(ctx, sendCtx, err,
 				"failed to send notification",
 				"calendar", notification.Calendar,
+				"thread_id", calendar.Config.ThreadID,
+				"shutting_down", ctx.Err() != nil)
+			state.failed(notification.RemindedAt)
+			return
+		}
+
+		if ctx.Err() != nil {
+			slog.InfoContext(ctx,
+				"finished sending notification during shutdown",
+				"calendar", notification.Calendar,
+				"event", notification.Event.Summary)
+		}
+
+		recordDelivered(ctx, calendar, notification)
+		calendar.LastNotification = notification
+		calendar.LastMessage = message
+		if m != nil {
+			calendar.recordSent(notification, m.ID, time.Now())
+		}
+	}
+
+	sendBatch := func(ctx context.Context, cal *trackedCalendar, batch []calendar.Notification) {
+		var notifications []calendar.Notification
+		var messages []*webhook.ExecuteData
+		// The batch is invalid once its first event starts.
+		expireAfter := time.Duration(math.MaxInt64)
+
+		for _, notification := range batch {
+			message, err := createNotificationMessage(cal, notification)
+			if err != nil {
+				slog.ErrorContext(ctx,
+					"failed to create notification message",
+					"calendar", notification.Calendar,
+					"error", err)
+				continue
+			}
+			notifications = append(notifications, notification)
+			messages = append(messages, message)
+			if d := notification.Event.StartsAt.Sub(notification.RemindedAt); d < expireAfter {
+				expireAfter = d
+			}
+		}
+
+		if len(messages) == 0 {
+			return
+		}
+
+		detachedCtx, cancel := detachContext(ctx, shutdownTimeout)
+		defer cancel()
+
+		sendCtx, cancel := context.WithTimeout(detachedCtx, expireAfter)
+		defer cancel()
+
+		flags := cal.batchFlags(notifications)
+
+		for _, message := range combineMessages(messages) {
+			err := cal.withWebhook(sendCtx, func(c *webhook.Client) error {
+				_, err := executeWithFlags(c, message.ExecuteData, flags, false)
+				return err
+			})
+			if err != nil {
+				logSendFailure(ctx, sendCtx, err,
+					"failed to send batched notifications",
+					"calendar", cal.Config.ICalURL,
+					"thread_id", cal.Config.ThreadID,
+					"notifications", message.Count)
+				for _, notification := range notifications {
+					state.failed(notification.RemindedAt)
+				}
+				return
+			}
+
+			sent := notifications[:message.Count]
+			notifications = notifications[message.Count:]
+
+			for _, notification := range sent {
+				recordDelivered(ctx, cal, notification)
+			}
+			data := message.ExecuteData
+			cal.LastNotification = sent[len(sent)-1]
+			cal.LastMessage = &data
+		}
+	}
+
+	sendNotifications := func(ctx context.Context, notifications []calendar.Notification) {
+		var batchable []calendar.Notification
+		for _, notification := range notifications {
+			cal := findCalendar(calendars, notification.Calendar)
+			if cal == nil || !cal.batchable(notification) ||
+				(delivered != nil && delivered.has(cal.Config.ICalURL, notification)) {
+				sendNotification(ctx, notification)
+				continue
+			}
+			batchable = append(batchable, notification)
+		}
+
+		for _, batch := range batchNotifications(batchable, cfg.BatchWindow.Duration()) {
+			if len(batch) == 1 {
+				sendNotification(ctx, batch[0])
+				continue
+			}
+			sendBatch(ctx, findCalendar(calendars, batch[0].Calendar), batch)
+		}
+	}
+
+	resendLastNotifications := func(ctx context.Context) {
+		for _, cal := range calendars {
+			if cal.LastMessage == nil {
+				continue
+			}
+
+			slog.InfoContext(ctx,
+				"re-sending last notification",
+				"calendar", cal.Config.ICalURL,
+				"event", cal.LastNotification.Event.Summary)
+
+			if _, err := cal.executeNotification(ctx, cal.LastNotification, *cal.LastMessage); err != nil {
+				slog.ErrorContext(ctx,
+					"failed to re-send last notification",
+					"calendar", cal.Config.ICalURL,
+					"error", err)
+			}
+		}
+	}
+
+	// saveLastProcessed saves the notification as processed, unless it or an
+	// earlier notification failed to be sent.
+	saveLastProcessed := func(ctx context.Context, notification calendar.Notification) {
+		if cfg.StateFile == "" || !state.processed(notification.RemindedAt) {
+			return
+		}
+
+		if err := saveRunState(cfg.StateFile, state); err != nil {
+			slog.ErrorContext(ctx,
+				"failed to save state",
+				"path", cfg.StateFile,
+				"error", err)
+		}
+	}
+
+	// Allow re-sending the last notification on demand, e.g. to check the
+	// message formatting after editing a template.
+	resendCh := make(chan os.Signal, 1)
+	signal.Notify(resendCh, syscall.SIGUSR1)
+	defer signal.Stop(resendCh)
+
+	// startOverviews starts the weekly overviews of the current calendars.
+	// The returned function stops them and waits for them to return.
+	startOverviews := func() (stop func()) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		var wg sync.WaitGroup
+		for _, cal := range calendars {
+			if cal.Config.WeeklyOverview == nil {
+				continue
+			}
+
+			cal := cal
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runWeeklyOverview(ctx, cal, *cal.Config.WeeklyOverview, eventsOpts, cal.Location)
+			}()
+		}
+
+		return func() {
+			cancel()
+			wg.Wait()
+		}
+	}
+
+	stopOverviews := startOverviews()
+	defer func() { stopOverviews() }()
+
+	reloadConfig := func(ctx context.Context) {
+		newCfg, err := loadConfig(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx,
+				"failed to reload config, keeping the current one",
+				"error", err)
+			return
+		}
+
+		newCalendars, err := newTrackedCalendars(ctx, newCfg, location, calendars)
+		if err != nil {
+			slog.ErrorContext(ctx,
+				"failed to reload config, keeping the current one",
 				"error", err)
 			return
 		}
+
+		if restartRequired(cfg, newCfg) {
+			slog.WarnContext(ctx,
+				"config changes outside of calendars require a restart to take effect")
+		}
+
+		// Only fetch the calendars that weren't fetched before.
+		var unfetched []*trackedCalendar
+		for _, cal := range newCalendars {
+			if !slices.ContainsFunc(calendars, func(old *trackedCalendar) bool { return old.Calendar == cal.Calendar }) {
+				unfetched = append(unfetched, cal)
+			}
+		}
+
+		stopOverviews()
+		calendars = newCalendars
+		if health != nil {
+			health.setCalendars(calendars)
+		}
+		refreshCalendars(ctx, unfetched)
+		notifier.Update(updateCalendars)
+		stopOverviews = startOverviews()
+
+		slog.InfoContext(ctx,
+			"config reloaded",
+			"calendars", len(calendars))
 	}
 
+	// Reload the calendars on demand, e.g. after editing the config.
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	defer signal.Stop(reloadCh)
+
 	errg.Go(func() error {
-		refreshCalendar(ctx)
 		for {
 			select {
 			case <-ctx.Done():
@@ -175,14 +591,29 @@ func run(ctx context.Context) error {
 				slog.DebugContext(ctx,
 					"refreshing calendar",
 					"refresh_frequency", cfg.RefreshFrequency.Duration())
-				refreshCalendar(ctx)
-			case notification := <-notification:
-				slog.DebugContext(ctx,
-					"received notification",
-					"event", notification.Event.Summary,
-					"starts_at", notification.Event.StartsAt,
-					"reminded_at", notification.RemindedAt)
-				sendNotification(ctx, notification)
+				refreshCalendars(ctx, calendars)
+			case first := <-notification:
+				notifications := []calendar.Notification{first}
+				if cfg.BatchWindow > 0 {
+					notifications = receiveBatch(ctx, notification, first)
+				}
+
+				for _, notification := range notifications {
+					slog.DebugContext(ctx,
+						"received notification",
+						"event", notification.Event.Summary,
+						"starts_at", notification.Event.StartsAt,
+						"reminded_at", notification.RemindedAt)
+				}
+
+				sendNotifications(ctx, notifications)
+				for _, notification := range notifications {
+					saveLastProcessed(ctx, notification)
+				}
+			case <-resendCh:
+				resendLastNotifications(ctx)
+			case <-reloadCh:
+				reloadConfig(ctx)
 			}
 		}
 	})
@@ -190,61 +621,434 @@ func run(ctx context.Context) error {
 	return errg.Wait()
 }
 
+// logSendFailure logs that sending notifications failed with err. If it
+// failed because the notifications expired, i.e. their event started before
+// they could be sent, e.g. because Discord kept rate limiting us, a distinct
+// warning is logged instead. sendCtx is the context the send was bounded by.
+func logSendFailure(ctx, sendCtx context.Context, err error, msg string, args ...any) {
+	args = append(args, "error", err)
+	if sendExpired(sendCtx, err) {
+		slog.WarnContext(ctx, "reminder expired before it could be sent", args...)
+		return
+	}
+	slog.ErrorContext(ctx, msg, args...)
+}
+
+// shutdownTimeout is how long in-flight webhook requests are given to complete
+// after shutdown is requested.
+const shutdownTimeout = 10 * time.Second
+
+// detachContext returns a context that is not cancelled when ctx is, but only
+// timeout after ctx is done. It is used to let in-flight requests complete
+// during shutdown.
+func detachContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-detached.Done():
+		}
+	})
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
+
 type trackedCalendar struct {
 	Calendar        *calendar.OnlineICSCalendar
 	WebhookClient   *webhook.Client
+	WebhookSem      semaphore
+	WebhookLimiter  *rateLimiter
 	MessageTemplate *template.Template
+	EmbedURL        *template.Template
+	WebhookUsername *template.Template
+	EmbedStyles     map[calendar.NotificationKind]embedStyle
+	ReminderRe      *regexp.Regexp
+	ParseReminder   calendar.ReminderParseFunc
+	SummaryExclude  *regexp.Regexp
+	Location        *time.Location
 	Config          calendarConfig
+	// Position is the position of the calendar in the config.
+	Position int
+
+	// LastNotification and LastMessage are the most recently delivered
+	// notification and its rendered message. They are only accessed from
+	// the main event loop.
+	LastNotification calendar.Notification
+	LastMessage      *webhook.ExecuteData
+	// SentMessages are the messages sent for each event occurrence, if
+	// cancelled_messages is "edit" or "delete". It is only accessed from the
+	// main event loop.
+	SentMessages map[sentKey]sentMessages
+}
+
+var (
+	_ calendar.Calendar   = (*trackedCalendar)(nil)
+	_ calendar.Identifier = (*trackedCalendar)(nil)
+)
+
+// newTrackedCalendars creates the tracked calendars of the config. Calendars
+// with the same ical_url, credentials and fetch_timeout as one of the previous
+// calendars share its already fetched data, and calendars with the same
+// CalendarID keep its record of delivered messages. Previous may be nil.
+func newTrackedCalendars(ctx context.Context, cfg *config, location *time.Location, previous []*trackedCalendar) ([]*trackedCalendar, error) {
+	calendars := make([]*trackedCalendar, len(cfg.Calendars))
+	for i, cfg := range cfg.Calendars {
+		cal, err := newTrackedCalendar(ctx, cfg, cfg.location(location))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create calendar %q", cfg.ICalURL)
+		}
+		cal.Position = i
+
+		for _, old := range previous {
+			if old.Calendar.ICalURL == cal.Calendar.ICalURL &&
+				headerEqual(old.Calendar.Header, cal.Calendar.Header) &&
+				old.Config.FetchTimeout == cal.Config.FetchTimeout {
+				cal.Calendar = old.Calendar
+			}
+			if old.CalendarID() == cal.CalendarID() {
+				cal.LastNotification = old.LastNotification
+				cal.LastMessage = old.LastMessage
+				cal.SentMessages = old.SentMessages
+			}
+		}
+
+		calendars[i] = cal
+	}
+	return calendars, nil
 }
 
-func newTrackedCalendar(cfg calendarConfig) (*trackedCalendar, error) {
+func headerEqual(a, b http.Header) bool {
+	return maps.EqualFunc(a, b, slices.Equal[[]string])
+}
+
+func newTrackedCalendar(ctx context.Context, cfg calendarConfig, location *time.Location) (*trackedCalendar, error) {
 	webhookClient, err := webhook.NewFromURL(cfg.WebhookURL)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create webhook")
 	}
+	// Discord's rate limits are retried by withWebhook, which bounds the
+	// retries and respects the reminder's deadline.
+	webhookClient.Client.Retries = 1
 
-	messageTemplate, err := template.New("").Parse(cfg.MessageTemplate)
+	messageTemplate, err := template.New("").
+		Funcs(templateFuncs(location, time.Now)).
+		Parse(cfg.MessageTemplate)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse message template")
 	}
 
+	var embedURL *template.Template
+	if cfg.EmbedURLTemplate != "" {
+		embedURL, err = template.New("").
+			Funcs(templateFuncs(location, time.Now)).
+			Parse(cfg.EmbedURLTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse embed URL template")
+		}
+	}
+
+	var webhookUsername *template.Template
+	if cfg.WebhookUsername != "" {
+		webhookUsername, err = template.New("").
+			Funcs(templateFuncs(location, time.Now)).
+			Parse(cfg.WebhookUsername)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse webhook username template")
+		}
+	}
+
+	if cfg.WebhookAvatarURL != "" {
+		if err := validateHTTPURL(cfg.WebhookAvatarURL); err != nil {
+			return nil, errors.Wrap(err, "invalid webhook avatar URL")
+		}
+	}
+
+	if err := validateCancelledMessages(cfg.CancelledMessages); err != nil {
+		return nil, err
+	}
+
+	if err := validateDestinations(cfg); err != nil {
+		return nil, err
+	}
+
+	embedStyles, err := newEmbedStyles(cfg.Embed.Color, cfg.EmbedStyles)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create embed styles")
+	}
+
+	reminderRe, err := compileReminderPattern(cfg.ReminderPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaryExclude *regexp.Regexp
+	if cfg.ExcludeSummary != "" {
+		summaryExclude, err = regexp.Compile(cfg.ExcludeSummary)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile exclude_summary")
+		}
+	}
+
 	return &trackedCalendar{
-		Calendar:        calendar.NewOnlineICSCalendar(cfg.ICalURL),
+		Calendar:        cfg.onlineCalendar(),
 		WebhookClient:   webhookClient,
+		WebhookSem:      newSemaphore(cfg.MaxInFlight),
+		WebhookLimiter:  newRateLimiter(cfg.MaxMessagesPerMinute),
 		MessageTemplate: messageTemplate,
+		EmbedURL:        embedURL,
+		WebhookUsername: webhookUsername,
+		EmbedStyles:     embedStyles,
+		ReminderRe:      reminderRe,
+		ParseReminder:   newDiscordRemindersParser(ctx, reminderRe),
+		SummaryExclude:  summaryExclude,
+		Location:        location,
 		Config:          cfg,
+		SentMessages:    make(map[sentKey]sentMessages),
 	}, nil
 }
 
+// withWebhook calls fn with the calendar's webhook client bound to ctx. It
+// limits the number of concurrent webhook requests to the calendar's
+// max_in_flight, paces them to max_messages_per_minute, and bounds each
+// request by the calendar's request_timeout. If Discord rate limits the
+// request, fn is retried once the rate limit is over, up to
+// maxRateLimitRetries times and as long as that is before ctx's deadline.
+func (c *trackedCalendar) withWebhook(ctx context.Context, fn func(*webhook.Client) error) error {
+	if err := c.WebhookSem.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.WebhookSem.release()
+
+	for retries := 0; ; retries++ {
+		if err := c.WebhookLimiter.wait(ctx); err != nil {
+			return err
+		}
+
+		err := c.callWebhook(ctx, fn)
+
+		retryAfter, ok := rateLimitedFor(err)
+		if !ok {
+			return err
+		}
+		if retries == maxRateLimitRetries {
+			return errors.Wrapf(err, "still rate limited after %d retries", retries)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(retryAfter).After(deadline) {
+			c.WebhookLimiter.pause(retryAfter)
+			return errors.Wrapf(errRateLimitPastDeadline, "retry after %v", retryAfter)
+		}
+
+		slog.WarnContext(ctx,
+			"webhook rate limited, retrying",
+			"calendar", c.Config.ICalURL,
+			"retry_after", retryAfter)
+
+		c.WebhookLimiter.pause(retryAfter)
+	}
+}
+
+func (c *trackedCalendar) callWebhook(ctx context.Context, fn func(*webhook.Client) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Config.requestTimeout())
+	defer cancel()
+
+	return fn(c.WebhookClient.WithContext(ctx))
+}
+
+// execute executes the calendar's webhook with the given data.
+func (c *trackedCalendar) execute(ctx context.Context, data webhook.ExecuteData) error {
+	return c.withWebhook(ctx, func(c *webhook.Client) error { return c.Execute(data) })
+}
+
+// executeNotification executes the calendar's webhook with the given message
+// for the notification, suppressing pings if the reminder's action is silent.
+// The sent message is only returned if the calendar tracks sent messages.
+func (c *trackedCalendar) executeNotification(ctx context.Context, n calendar.Notification, data webhook.ExecuteData) (m *discord.Message, err error) {
+	err = c.withWebhook(ctx, func(wh *webhook.Client) error {
+		m, err = executeWithFlags(wh, data, c.messageFlags(n), c.tracksSent())
+		return err
+	})
+	return
+}
+
+// messageFlags returns the message flags to send the notification with.
+func (c *trackedCalendar) messageFlags(n calendar.Notification) discord.MessageFlags {
+	if n.Action != "" && slices.Contains(c.Config.silentActions(), n.Action) {
+		return discord.SuppressNotifications
+	}
+	return 0
+}
+
+// CalendarID implements calendar.Identifier. Calendars are identified by their
+// calendar and webhook URLs, so that they keep their identity when the config
+// is reloaded.
+func (c *trackedCalendar) CalendarID() string {
+	return c.Config.ICalURL + " " + c.Config.WebhookURL
+}
+
+// String implements fmt.Stringer.
+func (c *trackedCalendar) String() string {
+	return c.Calendar.String()
+}
+
+// EventsBetween implements calendar.Calendar. It parses reminders using the
+// calendar's own reminder pattern, and filters events using its categories
+// and summary filters.
+func (c *trackedCalendar) EventsBetween(start, end time.Time, opts calendar.EventsOpts) []calendar.Event {
+	opts.ParseReminder = c.ParseReminder
+	opts.IncludeCategories = c.Config.Categories
+	opts.ExcludeCategories = c.Config.ExcludeCategories
+	opts.SummaryExclude = c.SummaryExclude
+	opts.ReminderDestination = c.actionDestination
+	// Floating times are in the calendar's own timezone.
+	return c.Calendar.EventsBetween(start.In(c.Location), end.In(c.Location), opts)
+}
+
+// EventIDs implements calendar.EventLister.
+func (c *trackedCalendar) EventIDs(*time.Location) ([]calendar.EventID, bool) {
+	// Floating times are in the calendar's own timezone.
+	return c.Calendar.EventIDs(c.Location)
+}
+
 func findCalendar(calendars []*trackedCalendar, c calendar.Calendar) *trackedCalendar {
-	i := slices.IndexFunc(calendars, func(t *trackedCalendar) bool { return t.Calendar == c })
+	i := slices.IndexFunc(calendars, func(t *trackedCalendar) bool { return t == c })
 	if i == -1 {
-		return nil
+		// The calendar may have been replaced by reloading the config.
+		old, ok := c.(*trackedCalendar)
+		if !ok {
+			return nil
+		}
+		i = slices.IndexFunc(calendars, func(t *trackedCalendar) bool {
+			return t.CalendarID() == old.CalendarID()
+		})
+		if i == -1 {
+			return nil
+		}
 	}
 	return calendars[i]
 }
 
-var discordReminderRe = regexp.MustCompile(`Remind on Discord (.+?) before the event\.`)
+func notificationOrder(name string) (calendar.NotificationOrder, error) {
+	switch name {
+	case "", "start_time":
+		return calendar.OrderByStartTime, nil
+	case "priority":
+		return calendar.OrderByPriority, nil
+	case "calendar":
+		return orderByPosition, nil
+	default:
+		return nil, errors.Errorf("unknown notification order %q", name)
+	}
+}
+
+func parseDefaultRemindersMode(name string) (calendar.DefaultRemindersMode, error) {
+	switch mode := calendar.DefaultRemindersMode(name); mode {
+	case "", calendar.DefaultRemindersAlways:
+		return calendar.DefaultRemindersAlways, nil
+	case calendar.DefaultRemindersOnlyIfNoneParsed:
+		return mode, nil
+	default:
+		return "", errors.Errorf("unknown default reminders mode %q", name)
+	}
+}
+
+// orderByPosition orders notifications by the position of their calendar in
+// the config. Unlike calendar.OrderByCalendar, it keeps working after the
+// calendars are reloaded. Ties are broken by start time.
+func orderByPosition(a, b calendar.Notification) int {
+	position := func(c calendar.Calendar) int {
+		if t, ok := c.(*trackedCalendar); ok {
+			return t.Position
+		}
+		return math.MaxInt
+	}
+	if c := cmp.Compare(position(a.Calendar), position(b.Calendar)); c != 0 {
+		return c
+	}
+	return calendar.OrderByStartTime(a, b)
+}
+
+// discordReminderRe is the default reminder pattern. Its capture group is the
+// duration before the event.
+var discordReminderRe = regexp.MustCompile(`Remind on Discord (?P<duration>.+?) before the event\.`)
+
+// compileReminderPattern compiles a reminder_pattern, which must have exactly
+// one capture group for the duration. If the capture group is named, it must
+// be named "duration". An empty pattern is the default discordReminderRe.
+func compileReminderPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return discordReminderRe, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile reminder pattern")
+	}
+	if n := re.NumSubexp(); n != 1 {
+		return nil, errors.Errorf("reminder pattern must have exactly one capture group for the duration, got %d", n)
+	}
+	if name := re.SubexpNames()[1]; name != "" && name != "duration" {
+		return nil, errors.Errorf("reminder pattern's capture group must be named \"duration\", got %q", name)
+	}
+	return re, nil
+}
+
+// reminderDurationSepRe separates multiple durations in a reminder directive.
+var reminderDurationSepRe = regexp.MustCompile(`\s*(?:,|\band\b)\s*`)
 
-func newDiscordRemindersParser(ctx context.Context) calendar.ReminderParseFunc {
+// reminderDurationRef is the time that reminder durations are parsed relative
+// to. Going back by whole days, weeks or months, naturaldate lands on the start
+// of that day, week or month, so the reference is the start of all of them:
+// a Monday, the 1st of January, at midnight.
+var reminderDurationRef = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parseReminderDuration parses how long before an event a reminder is, e.g.
+// "1 day" or "15 minutes".
+func parseReminderDuration(s string) (time.Duration, error) {
+	t, err := naturaldate.Parse(s, reminderDurationRef, naturaldate.WithDirection(naturaldate.Past))
+	if err != nil {
+		return 0, err
+	}
+
+	d := reminderDurationRef.Sub(t)
+	if d <= 0 {
+		return 0, errors.Errorf("%q is not a duration before the event", s)
+	}
+	return d, nil
+}
+
+func newDiscordRemindersParser(ctx context.Context, reminderRe *regexp.Regexp) calendar.ReminderParseFunc {
 	return func(e calendar.Event) []calendar.Reminder {
-		matches := discordReminderRe.FindAllStringSubmatch(e.Description, -1)
+		matches := reminderRe.FindAllStringSubmatch(e.Description, -1)
 		reminders := make([]calendar.Reminder, 0, len(matches))
 
 		for _, m := range matches {
-			t, err := naturaldate.Parse(m[1], e.StartsAt, naturaldate.WithDirection(naturaldate.Past))
-			if err != nil {
-				slog.WarnContext(ctx,
-					"failed to parse Discord reminder duration",
-					"event", e.Summary,
-					"duration", m[1],
-					"err", err)
-				continue
+			// A single directive may contain multiple durations, e.g.
+			// "1 day and 1 hour".
+			for _, duration := range reminderDurationSepRe.Split(m[1], -1) {
+				if duration == "" {
+					continue
+				}
+
+				d, err := parseReminderDuration(duration)
+				if err != nil {
+					slog.WarnContext(ctx,
+						"failed to parse Discord reminder duration",
+						"event", e.Summary,
+						"duration", duration,
+						"err", err)
+					continue
+				}
+				reminders = append(reminders, calendar.Reminder{
+					Action:   "DISCORD",
+					RemindAt: e.StartsAt.Add(-d),
+				})
 			}
-			reminders = append(reminders, calendar.Reminder{
-				Action:   "DISCORD",
-				RemindAt: t,
-			})
 		}
 
 		return reminders
@@ -253,45 +1057,220 @@ func newDiscordRemindersParser(ctx context.Context) calendar.ReminderParseFunc {
 
 func createNotificationMessage(cal *trackedCalendar, notification calendar.Notification) (*webhook.ExecuteData, error) {
 	description := notification.Event.Description
-	description = discordReminderRe.ReplaceAllString(description, "")
+	description = cal.ReminderRe.ReplaceAllString(description, "")
 	description = strings.TrimSpace(description)
 
+	style := cal.EmbedStyles[notification.Kind]
+
+	title, err := style.renderTitle(notification)
+	if err != nil {
+		return nil, err
+	}
+
 	embed := discord.Embed{
-		Title:       notification.Event.Summary,
+		Title:       title,
 		Description: description,
-		Color:       0x2c91c6,
-		Fields: []discord.EmbedField{
-			{
-				Name:   "Start Time",
-				Value:  fmt.Sprintf("<t:%d:R>", notification.Event.StartsAt.Unix()),
-				Inline: true,
-			},
-			{
-				Name:   "Duration",
-				Value:  humanDuration(notification.Event.EndsAt.Sub(notification.Event.StartsAt)),
-				Inline: true,
-			},
-		},
-	}
-	if notification.Event.Location != "" {
+		Color:       style.Color,
+	}
+	show := cal.Config.Embed.showField
+	if show("start_time") {
+		embed.Fields = append(embed.Fields, startTimeField(notification.Event))
+	}
+	// Skip the duration for events without a meaningful end time.
+	duration := notification.Event.EndsAt.Sub(notification.Event.StartsAt)
+	if duration > 0 && show("duration") &&
+		!(notification.Event.AllDay && cal.Config.Embed.HideAllDayDuration) {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   "Duration",
+			Value:  humanDuration(duration),
+			Inline: true,
+		})
+	}
+	if recurrence := notification.Event.Recurrence; recurrence != nil && show("repeats") {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   "Repeats",
+			Value:  recurrence.String(),
+			Inline: true,
+		})
+	}
+	if cal.EmbedURL != nil {
+		u, err := renderEmbedURL(cal.EmbedURL, notification)
+		if err != nil {
+			return nil, err
+		}
+		embed.URL = u
+	}
+	if style.Label != "" && show("status") {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   "Status",
+			Value:  style.Label,
+			Inline: true,
+		})
+	}
+	if cal.Config.ShowTimezone && !notification.Event.AllDay {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   "Local Time",
+			Value:  localTime(notification.Event.StartsAt, cal.Location),
+			Inline: true,
+		})
+	}
+	if location := eventLocation(cal, notification.Event); location != "" && show("location") {
 		embed.Fields = append(embed.Fields, discord.EmbedField{
 			Name:   "Location",
-			Value:  notification.Event.Location,
+			Value:  location,
 			Inline: true,
 		})
 	}
+	if cal.Config.ShowAttendees {
+		embed.Fields = append(embed.Fields, attendeeFields(notification.Event)...)
+	}
+
+	capEmbed(&embed, embedLimits{
+		MaxFields:      cal.Config.MaxEmbedFields,
+		MaxDescription: cal.Config.MaxEmbedDescription,
+	})
 
 	var content strings.Builder
+	content.WriteString(cal.Config.Prefix)
 	if err := cal.MessageTemplate.Execute(&content, notification); err != nil {
 		return nil, errors.Wrap(err, "failed to execute message template")
 	}
+	content.WriteString(cal.Config.Suffix)
+
+	var username string
+	if cal.WebhookUsername != nil {
+		username, err = renderWebhookUsername(cal.WebhookUsername, notification)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &webhook.ExecuteData{
-		Content: content.String(),
-		Embeds:  []discord.Embed{embed},
+		Content:   content.String(),
+		Username:  username,
+		AvatarURL: discord.URL(cal.Config.WebhookAvatarURL),
+		Embeds:    []discord.Embed{embed},
+		ThreadID:  discord.CommandID(cal.Config.ThreadID),
 	}, nil
 }
 
+// maxWebhookUsername is the maximum length of a webhook username.
+const maxWebhookUsername = 80
+
+// renderWebhookUsername renders the webhook username template for the given
+// notification. The result is truncated to Discord's limit.
+func renderWebhookUsername(tmpl *template.Template, notification calendar.Notification) (string, error) {
+	var s strings.Builder
+	if err := tmpl.Execute(&s, notification); err != nil {
+		return "", errors.Wrap(err, "failed to execute webhook username template")
+	}
+
+	username := strings.Join(strings.Fields(s.String()), " ")
+	return truncateText(username, maxWebhookUsername), nil
+}
+
+// startTimeField returns the embed field showing when the event starts. All-day
+// events show their date, since a countdown to midnight would be misleading.
+func startTimeField(event calendar.Event) discord.EmbedField {
+	if event.AllDay {
+		return discord.EmbedField{
+			Name:   "Date",
+			Value:  allDayDate(event),
+			Inline: true,
+		}
+	}
+	return discord.EmbedField{
+		Name:   "Start Time",
+		Value:  fmt.Sprintf("<t:%d:R>", event.StartsAt.Unix()),
+		Inline: true,
+	}
+}
+
+// attendeeFields returns the embed fields listing the event's organizer and
+// attendees, if it has any.
+func attendeeFields(event calendar.Event) []discord.EmbedField {
+	var fields []discord.EmbedField
+	if event.Organizer != "" {
+		fields = append(fields, discord.EmbedField{
+			Name:   "Organizer",
+			Value:  event.Organizer,
+			Inline: true,
+		})
+	}
+	if len(event.Attendees) > 0 {
+		names := make([]string, 0, len(event.Attendees))
+		for _, attendee := range event.Attendees {
+			// Prefer the shorter name over the whole address.
+			name := attendee.Name
+			if name == "" {
+				name = attendee.Email
+			}
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			fields = append(fields, discord.EmbedField{
+				Name:  "Attendees",
+				Value: strings.Join(names, ", "),
+			})
+		}
+	}
+	return fields
+}
+
+// allDayDate formats the date of an all-day event. Unlike Discord timestamps,
+// which are shown in each user's timezone and could therefore be off by a
+// day, it is formatted in the calendar's timezone.
+func allDayDate(event calendar.Event) string {
+	return event.StartsAt.Format("Monday, January 2, 2006")
+}
+
+// renderEmbedURL renders the embed URL template for the given notification and
+// validates the result. An empty result is allowed.
+func renderEmbedURL(tmpl *template.Template, notification calendar.Notification) (string, error) {
+	var s strings.Builder
+	if err := tmpl.Execute(&s, notification); err != nil {
+		return "", errors.Wrap(err, "failed to execute embed URL template")
+	}
+
+	rawURL := strings.TrimSpace(s.String())
+	if rawURL == "" {
+		return "", nil
+	}
+
+	if err := validateHTTPURL(rawURL); err != nil {
+		return "", errors.Wrap(err, "embed URL template produced an invalid URL")
+	}
+
+	return rawURL, nil
+}
+
+// validateHTTPURL checks that rawURL is an absolute HTTP or HTTPS URL.
+func validateHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("%q is not an HTTP URL", rawURL)
+	}
+	return nil
+}
+
+// eventLocation returns the location of the event, falling back to its URL
+// and then to the calendar's default location.
+func eventLocation(cal *trackedCalendar, event calendar.Event) string {
+	switch {
+	case event.Location != "":
+		return event.Location
+	case event.URL != "":
+		return event.URL
+	default:
+		return cal.Config.DefaultLocation
+	}
+}
+
 func humanDuration(d time.Duration) string {
 	fmt := durafmt.Parse(d)
 	fmt = fmt.LimitToUnit("days")
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+const testWebhookURL = "https://discord.com/api/webhooks/1/token"
+
+func TestCreateNotificationMessage_reminderPattern(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:      testWebhookURL,
+		ReminderPattern: `\[remind (.+?) before\]`,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	event := calendar.Event{
+		StartsAt:    startsAt,
+		EndsAt:      startsAt.Add(time.Hour),
+		Summary:     "Meeting",
+		Description: "Weekly sync. [remind 1 hour before]",
+	}
+
+	reminders := cal.ParseReminder(event)
+	assert.Equal(t, 1, len(reminders))
+	assert.True(t, reminders[0].RemindAt.Equal(startsAt.Add(-time.Hour)))
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar:   cal,
+		Event:      event,
+		RemindedAt: reminders[0].RemindAt,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Weekly sync.", message.Embeds[0].Description)
+}
+
+func TestDiscordRemindersParser_multipleDurations(t *testing.T) {
+	parse := newDiscordRemindersParser(context.Background(), discordReminderRe)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	reminders := parse(calendar.Event{
+		StartsAt:    startsAt,
+		Description: "Remind on Discord 15 minutes and 1 day before the event.",
+	})
+
+	assert.Equal(t, 2, len(reminders))
+	assert.True(t, reminders[0].RemindAt.Equal(startsAt.Add(-15*time.Minute)))
+	assert.True(t, reminders[1].RemindAt.Equal(startsAt.Add(-24*time.Hour)))
+}
+
+func TestParseReminderDuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect time.Duration
+		err    bool
+	}{
+		{"15 minutes", 15 * time.Minute, false},
+		{"1 hour", time.Hour, false},
+		{"2 days", 48 * time.Hour, false},
+		{"1 week", 7 * 24 * time.Hour, false},
+		{"1 day and 1 hour", 25 * time.Hour, false},
+		{"soon", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			d, err := parseReminderDuration(test.in)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expect, d)
+		})
+	}
+}
+
+func TestNewTrackedCalendar_reminderPatternWithoutGroup(t *testing.T) {
+	_, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:      testWebhookURL,
+		ReminderPattern: `\[remind\]`,
+	}, time.UTC)
+	assert.Error(t, err)
+}
+
+func TestCompileReminderPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     bool
+	}{
+		{"", false},
+		{`Discord reminder: (?P<duration>.+?) prior`, false},
+		{`Discord reminder: (.+?) prior`, false},
+		{`Discord reminder: (?:in )?(.+?) prior`, false},
+		{`Discord reminder: (?P<before>.+?) prior`, true},
+		{`Discord reminder: (.+?) (prior|before)`, true},
+		{`Discord reminder: (.+? prior`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			_, err := compileReminderPattern(test.pattern)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDiscordRemindersParser_namedGroup(t *testing.T) {
+	re, err := compileReminderPattern(`Discord reminder: (?P<duration>.+?) prior\.?`)
+	assert.NoError(t, err)
+
+	parse := newDiscordRemindersParser(context.Background(), re)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	reminders := parse(calendar.Event{
+		StartsAt:    startsAt,
+		Description: "Bring slides. Discord reminder: 1 hour prior.",
+	})
+
+	assert.Equal(t, 1, len(reminders))
+	assert.True(t, reminders[0].RemindAt.Equal(startsAt.Add(-time.Hour)))
+}
+
+func TestCreateNotificationMessage_cancelled(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	notification := calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			StartsAt: startsAt,
+			EndsAt:   startsAt.Add(time.Hour),
+			Summary:  "Meeting",
+			Status:   calendar.EventCancelled,
+		},
+		RemindedAt: startsAt.Add(-time.Hour),
+		Kind:       calendar.NotificationCancelled,
+	}
+
+	message, err := createNotificationMessage(cal, notification)
+	assert.NoError(t, err)
+
+	embed := message.Embeds[0]
+	assert.Equal(t, "~~Meeting~~", embed.Title)
+	assert.Equal(t, discord.Color(0xd9534f), embed.Color)
+	assert.Contains(t, embedFieldNames(embed), "Status")
+
+	notification.Kind = calendar.NotificationReminder
+
+	message, err = createNotificationMessage(cal, notification)
+	assert.NoError(t, err)
+	assert.Equal(t, "Meeting", message.Embeds[0].Title)
+	assert.Equal(t, discord.Color(0x2c91c6), message.Embeds[0].Color)
+}
+
+func TestCreateNotificationMessage_embedStyleOverride(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+		EmbedStyles: map[string]embedStyleConfig{
+			"cancelled": {Title: "CANCELLED: {{.Event.Summary}}"},
+		},
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event:    calendar.Event{Summary: "Meeting"},
+		Kind:     calendar.NotificationCancelled,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "CANCELLED: Meeting", message.Embeds[0].Title)
+	assert.Equal(t, discord.Color(0xd9534f), message.Embeds[0].Color)
+}
+
+func TestCreateNotificationMessage_embedConfig(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+		Embed: embedConfig{
+			Color:              0x123456,
+			Fields:             map[string]bool{"location": false, "start_time": true},
+			HideAllDayDuration: true,
+		},
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	notification := calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			StartsAt: startsAt,
+			EndsAt:   startsAt.Add(time.Hour),
+			Summary:  "Meeting",
+			Location: "Room 1",
+		},
+		Kind: calendar.NotificationReminder,
+	}
+
+	message, err := createNotificationMessage(cal, notification)
+	assert.NoError(t, err)
+	assert.Equal(t, discord.Color(0x123456), message.Embeds[0].Color)
+	assert.Equal(t, "Start Time, Duration", embedFieldNames(message.Embeds[0]))
+
+	notification.Event.AllDay = true
+	notification.Event.EndsAt = startsAt.AddDate(0, 0, 1)
+
+	message, err = createNotificationMessage(cal, notification)
+	assert.NoError(t, err)
+	assert.Equal(t, "Date", embedFieldNames(message.Embeds[0]))
+
+	// Other kinds keep their own colors.
+	notification.Kind = calendar.NotificationCancelled
+
+	message, err = createNotificationMessage(cal, notification)
+	assert.NoError(t, err)
+	assert.Equal(t, discord.Color(0xd9534f), message.Embeds[0].Color)
+}
+
+func TestCreateNotificationMessage_embedURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+		err      bool
+	}{
+		{"uid", "https://lms.example.com/events/{{.Event.UID}}", "https://lms.example.com/events/abc", false},
+		{"empty", "{{if .Event.URL}}{{.Event.URL}}{{end}}", "", false},
+		{"invalid", "not a url", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+				WebhookURL:       testWebhookURL,
+				EmbedURLTemplate: test.template,
+			}, time.UTC)
+			assert.NoError(t, err)
+
+			message, err := createNotificationMessage(cal, calendar.Notification{
+				Calendar: cal,
+				Event:    calendar.Event{UID: "abc", Summary: "Meeting"},
+			})
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, discord.URL(test.expect), message.Embeds[0].URL)
+		})
+	}
+}
+
+func TestCreateNotificationMessage_webhookIdentity(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:       testWebhookURL,
+		WebhookUsername:  "{{if .Event.Location}}{{.Event.Location}}{{else}}Gym{{end}}",
+		WebhookAvatarURL: "https://example.com/avatar.png",
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event:    calendar.Event{Summary: "Leg Day"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Gym", message.Username)
+	assert.Equal(t, discord.URL("https://example.com/avatar.png"), message.AvatarURL)
+
+	message, err = createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event:    calendar.Event{Summary: "Session 12", Location: "Dungeon"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Dungeon", message.Username)
+
+	_, err = newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:       testWebhookURL,
+		WebhookAvatarURL: "avatar.png",
+	}, time.UTC)
+	assert.Error(t, err)
+}
+
+func TestCreateNotificationMessage_duration(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		endsAt time.Time
+		expect bool
+	}{
+		{"positive", startsAt.Add(time.Hour), true},
+		{"zero", startsAt, false},
+		{"negative", startsAt.Add(-time.Hour), false},
+		{"unknown", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := createNotificationMessage(cal, calendar.Notification{
+				Calendar: cal,
+				Event: calendar.Event{
+					Summary:  "Meeting",
+					StartsAt: startsAt,
+					EndsAt:   test.endsAt,
+				},
+			})
+			assert.NoError(t, err)
+
+			names := embedFieldNames(message.Embeds[0])
+			if test.expect {
+				assert.Contains(t, names, "Duration")
+			} else {
+				assert.NotContains(t, names, "Duration")
+			}
+		})
+	}
+}
+
+func TestCreateNotificationMessage_allDay(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:   testWebhookURL,
+		ShowTimezone: true,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			Summary:  "Holiday",
+			StartsAt: startsAt,
+			EndsAt:   startsAt.AddDate(0, 0, 1),
+			AllDay:   true,
+		},
+	})
+	assert.NoError(t, err)
+
+	embed := message.Embeds[0]
+	assert.Equal(t, "Date, Duration", embedFieldNames(embed))
+	assert.Equal(t, "Monday, January 15, 2024", embed.Fields[0].Value)
+}
+
+func TestCreateNotificationMessage_attendees(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:    testWebhookURL,
+		ShowAttendees: true,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC)
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			Summary:   "Planning",
+			StartsAt:  startsAt,
+			EndsAt:    startsAt.Add(time.Hour),
+			Organizer: "Jane Doe <jane@example.com>",
+			Attendees: []calendar.Attendee{
+				{Name: "John Smith", Email: "john@example.com"},
+				{Email: "anon@example.com"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	embed := message.Embeds[0]
+	assert.Equal(t, "Start Time, Duration, Organizer, Attendees", embedFieldNames(embed))
+	assert.Equal(t, "Jane Doe <jane@example.com>", embed.Fields[2].Value)
+	assert.Equal(t, "John Smith, anon@example.com", embed.Fields[3].Value)
+}
+
+func TestCreateNotificationMessage_recurrence(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC)
+
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar: cal,
+		Event: calendar.Event{
+			Summary:  "Standup",
+			StartsAt: startsAt,
+			EndsAt:   startsAt.Add(15 * time.Minute),
+			Recurrence: &calendar.RecurrenceInfo{
+				Frequency: "WEEKLY",
+				Interval:  1,
+				Weekdays:  []time.Weekday{time.Monday, time.Thursday},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	embed := message.Embeds[0]
+	assert.Equal(t, "Start Time, Duration, Repeats", embedFieldNames(embed))
+	assert.Equal(t, "Weekly on Monday and Thursday", embed.Fields[2].Value)
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		in     time.Duration
+		expect string
+	}{
+		{50 * time.Minute, "50 minutes"},
+		{time.Minute, "1 minute"},
+		{time.Hour, "1 hour"},
+		{time.Hour + time.Minute, "1 hour 1 minute"},
+		{26*time.Hour + 30*time.Minute, "1 day 2 hours"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in.String(), func(t *testing.T) {
+			assert.Equal(t, test.expect, humanDuration(test.in))
+		})
+	}
+}
+
+func embedFieldNames(embed discord.Embed) string {
+	names := make([]string, len(embed.Fields))
+	for i, field := range embed.Fields {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestDetachContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	detached, detachedCancel := detachContext(ctx, 100*time.Millisecond)
+	defer detachedCancel()
+
+	cancel()
+
+	select {
+	case <-detached.Done():
+		t.Fatal("detached context was cancelled together with its parent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	select {
+	case <-detached.Done():
+	case <-time.After(time.Second):
+		t.Fatal("detached context was not cancelled after the timeout")
+	}
+}
+
+func TestTrackedCalendar_requestTimeout(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:     testWebhookURL,
+		RequestTimeout: durationValue(50 * time.Millisecond),
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	// The notification itself is still valid for an hour, but a webhook that
+	// never responds should only hold us up for the request timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	start := time.Now()
+	err = cal.withWebhook(ctx, func(c *webhook.Client) error {
+		<-c.Context().Done()
+		return c.Context().Err()
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
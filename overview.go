@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// maxEmbedFields is the maximum number of fields Discord allows in an embed.
+const maxEmbedFields = 25
+
+// runWeeklyOverview posts an overview of the upcoming events to the calendar's
+// webhook once a week, as configured. Events are filtered like the notifier's
+// with opts, except that cancelled events are always left out. It returns
+// when the context is done.
+func runWeeklyOverview(ctx context.Context, cal *trackedCalendar, cfg overviewConfig, opts calendar.EventsOpts, location *time.Location) error {
+	window := cfg.Window.Duration()
+	if window <= 0 {
+		window = 7 * calendar.Day
+	}
+
+	opts.ExcludeCancelled = true
+
+	for {
+		next := nextOverview(time.Now().In(location), cfg)
+		slog.DebugContext(ctx,
+			"weekly overview scheduled",
+			"calendar", cal.Config.ICalURL,
+			"at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		start := next
+		end := start.Add(window)
+
+		events := cal.EventsBetween(start, end, opts)
+
+		var message *webhook.ExecuteData
+		switch {
+		case len(events) >= cfg.minEvents():
+			message = createOverviewMessage(events, start, end)
+		case cfg.EmptyMessage != "":
+			message = &webhook.ExecuteData{Content: cfg.EmptyMessage}
+		default:
+			slog.DebugContext(ctx,
+				"too few events for weekly overview, skipping",
+				"calendar", cal.Config.ICalURL,
+				"events", len(events))
+			continue
+		}
+
+		message.ThreadID = discord.CommandID(cal.Config.ThreadID)
+
+		if err := cal.execute(ctx, *message); err != nil {
+			slog.ErrorContext(ctx,
+				"failed to send weekly overview",
+				"calendar", cal.Config.ICalURL,
+				"thread_id", cal.Config.ThreadID,
+				"error", err)
+		}
+	}
+}
+
+// nextOverview returns the next time after now that the overview should be
+// posted at.
+func nextOverview(now time.Time, cfg overviewConfig) time.Time {
+	days := (int(cfg.Weekday) - int(now.Weekday()) + 7) % 7
+	next := cfg.At.On(now.AddDate(0, 0, days))
+	if !next.After(now) {
+		next = cfg.At.On(now.AddDate(0, 0, days+7))
+	}
+	return next
+}
+
+func createOverviewMessage(events []calendar.Event, start, end time.Time) *webhook.ExecuteData {
+	embed := discord.Embed{
+		Title: "Upcoming Events",
+		Description: fmt.Sprintf(
+			"<t:%d:D> to <t:%d:D>",
+			start.Unix(), end.Unix()),
+		Color: 0x2c91c6,
+	}
+
+	for i, event := range events {
+		if i == maxEmbedFields {
+			embed.Footer = &discord.EmbedFooter{
+				Text: fmt.Sprintf("and %d more events", len(events)-maxEmbedFields),
+			}
+			break
+		}
+
+		value := fmt.Sprintf("<t:%d:F>", event.StartsAt.Unix())
+		if event.AllDay {
+			value = allDayDate(event)
+		}
+		if event.Location != "" {
+			value += "\n" + event.Location
+		}
+
+		name := event.Summary
+		if name == "" {
+			name = "Untitled event"
+		}
+
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	capEmbed(&embed, embedLimits{})
+
+	return &webhook.ExecuteData{
+		Embeds: []discord.Embed{embed},
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestNextOverview(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	// Mondays at 09:00.
+	cfg := overviewConfig{
+		At:      clockValue(9 * time.Hour),
+		Weekday: weekdayValue(time.Monday),
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		expect time.Time
+	}{
+		{
+			name:   "later_this_week",
+			now:    time.Date(2023, time.March, 15, 12, 0, 0, 0, berlin), // Wednesday
+			expect: time.Date(2023, time.March, 20, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:   "later_today",
+			now:    time.Date(2023, time.March, 20, 8, 30, 0, 0, berlin),
+			expect: time.Date(2023, time.March, 20, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:   "exactly_now",
+			now:    time.Date(2023, time.March, 20, 9, 0, 0, 0, berlin),
+			expect: time.Date(2023, time.March, 27, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:   "earlier_today",
+			now:    time.Date(2023, time.March, 20, 10, 0, 0, 0, berlin),
+			expect: time.Date(2023, time.March, 27, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:   "across_dst",
+			now:    time.Date(2023, time.March, 25, 12, 0, 0, 0, berlin), // Saturday
+			expect: time.Date(2023, time.March, 27, 9, 0, 0, 0, berlin),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := nextOverview(test.now, cfg)
+			assert.True(t, next.Equal(test.expect), "expected %v, got %v", test.expect, next)
+			assert.Equal(t, 9, next.Hour())
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// printPreview prints the first n of the given notifications that are due at
+// or after now, in the given location. The notifications must be sorted by
+// the time they are due.
+func printPreview(w io.Writer, notifications []calendar.Notification, n int, now time.Time, location *time.Location) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REMIND AT\tSTARTS AT\tSUMMARY\tACTION\tCALENDAR")
+
+	var printed int
+	for _, notification := range notifications {
+		if printed == n {
+			break
+		}
+		if notification.RemindedAt.Before(now) {
+			continue
+		}
+
+		var calendarURL string
+		if cal, ok := notification.Calendar.(*trackedCalendar); ok {
+			calendarURL = cal.Config.ICalURL
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			notification.RemindedAt.In(location).Format("Mon Jan 2 15:04 MST"),
+			notification.Event.StartsAt.In(location).Format("Mon Jan 2 15:04 MST"),
+			notification.Event.Summary,
+			notification.Action,
+			calendarURL)
+		printed++
+	}
+
+	if printed == 0 {
+		fmt.Fprintln(tw, "(no upcoming reminders)")
+	}
+	return tw.Flush()
+}
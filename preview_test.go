@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestPrintPreview(t *testing.T) {
+	cal := &trackedCalendar{Config: calendarConfig{ICalURL: "https://example.com/work.ics"}}
+	now := time.Date(2024, time.January, 15, 8, 0, 0, 0, time.UTC)
+	location := time.FixedZone("EST", -5*60*60)
+
+	notification := func(summary string, remindAt, startsAt time.Duration) calendar.Notification {
+		return calendar.Notification{
+			Calendar:   cal,
+			Event:      calendar.Event{Summary: summary, StartsAt: now.Add(startsAt)},
+			RemindedAt: now.Add(remindAt),
+			Action:     "DISCORD",
+		}
+	}
+
+	var b strings.Builder
+	err := printPreview(&b, []calendar.Notification{
+		notification("standup", -time.Hour, time.Hour),
+		notification("standup", 45*time.Minute, time.Hour),
+		notification("review", 2*time.Hour, 3*time.Hour),
+		notification("lunch", 3*time.Hour, 4*time.Hour),
+	}, 2, now, location)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Contains(t, lines[0], "REMIND AT")
+	assert.Contains(t, lines[1], "Mon Jan 15 03:45 EST")
+	assert.Contains(t, lines[1], "Mon Jan 15 04:00 EST")
+	assert.Contains(t, lines[1], "standup")
+	assert.Contains(t, lines[1], "https://example.com/work.ics")
+	assert.Contains(t, lines[2], "review")
+
+	b.Reset()
+	err = printPreview(&b, nil, 5, now, location)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "no upcoming reminders")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/pkg/errors"
+)
+
+// rateLimiter is a token bucket that allows bursts of up to its capacity and
+// refills at a steady rate. It can also be paused, e.g. because the server
+// asked us to back off.
+type rateLimiter struct {
+	mu sync.Mutex
+	// every is how long it takes to refill a single token. If it is zero,
+	// tokens are unlimited.
+	every time.Duration
+	burst int
+	// next is the time at which the bucket would have no tokens left had
+	// nothing been taken since. The bucket is full once next-now is at most
+	// zero.
+	next time.Time
+	// pausedUntil is the time before which no tokens are given out at all.
+	pausedUntil time.Time
+}
+
+// newRateLimiter creates a rate limiter that allows perMinute events per
+// minute. If perMinute is not positive, events are only limited while paused.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute < 1 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{
+		every: time.Minute / time.Duration(perMinute),
+		burst: perMinute,
+	}
+}
+
+// wait blocks until a token is available and takes it, or until the context
+// is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.reserve(now)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns the time at which it may be used.
+func (l *rateLimiter) reserve(now time.Time) time.Time {
+	if now.Before(l.pausedUntil) {
+		now = l.pausedUntil
+	}
+
+	if l.every == 0 {
+		return now
+	}
+
+	next := l.next
+	if next.Before(now) {
+		next = now
+	}
+
+	at := next.Add(-time.Duration(l.burst-1) * l.every)
+	if at.Before(now) {
+		at = now
+	}
+
+	l.next = next.Add(l.every)
+	return at
+}
+
+// pause stops handing out tokens for the given duration.
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// defaultRetryAfter is how long to back off if Discord rate limits a request
+// without saying for how long.
+const defaultRetryAfter = 5 * time.Second
+
+// maxRateLimitRetries is how many times a webhook request that Discord rate
+// limits is retried before giving up.
+const maxRateLimitRetries = 5
+
+// errRateLimitPastDeadline is returned if Discord asks to back off until past
+// the deadline of the request's context, so that retrying is pointless.
+var errRateLimitPastDeadline = errors.New("rate limited until past the deadline")
+
+// sendExpired returns true if sending failed because ctx, which is bounded by
+// the notification's expiry, ran out or would have while rate limited.
+func sendExpired(ctx context.Context, err error) bool {
+	return errors.Is(err, errRateLimitPastDeadline) || ctx.Err() == context.DeadlineExceeded
+}
+
+// rateLimitedFor returns how long to wait before retrying if err is a 429
+// response from Discord. It returns false for any other error.
+func rateLimitedFor(err error) (time.Duration, bool) {
+	var httpErr *httputil.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != httputil.StatusTooManyRequests {
+		return 0, false
+	}
+
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(httpErr.Body, &body) != nil || body.RetryAfter <= 0 {
+		return defaultRetryAfter, true
+	}
+
+	return time.Duration(body.RetryAfter * float64(time.Second)), true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	l := newRateLimiter(3)
+
+	// The first burst goes through immediately.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, now, l.reserve(now))
+	}
+
+	// After that, requests are paced.
+	assert.Equal(t, now.Add(20*time.Second), l.reserve(now))
+	assert.Equal(t, now.Add(40*time.Second), l.reserve(now))
+
+	// Once the bucket refills, bursts are allowed again.
+	later := now.Add(5 * time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, later, l.reserve(later))
+	}
+}
+
+func TestRateLimiter_pause(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	l := newRateLimiter(0)
+	assert.Equal(t, now, l.reserve(now))
+	assert.Equal(t, now, l.reserve(now))
+
+	l.pausedUntil = now.Add(time.Minute)
+	assert.Equal(t, now.Add(time.Minute), l.reserve(now))
+	assert.Equal(t, now.Add(2*time.Minute), l.reserve(now.Add(2*time.Minute)))
+}
+
+func TestRateLimitedFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		d    time.Duration
+		ok   bool
+	}{
+		{"nil", nil, 0, false},
+		{"other", errors.New("oops"), 0, false},
+		{"server error", &httputil.HTTPError{Status: 500}, 0, false},
+		{
+			"retry after",
+			&httputil.HTTPError{Status: 429, Body: []byte(`{"retry_after": 1.5}`)},
+			1500 * time.Millisecond, true,
+		},
+		{
+			"no body",
+			&httputil.HTTPError{Status: 429},
+			defaultRetryAfter, true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, ok := rateLimitedFor(test.err)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.d, d)
+		})
+	}
+}
+
+// newRateLimitedCalendar returns a calendar whose webhook is served by a stub
+// that responds with 429 to the first rateLimited requests, asking to retry
+// after retryAfter seconds, and the number of requests the stub received.
+func newRateLimitedCalendar(t *testing.T, rateLimited int32, retryAfter string) (*trackedCalendar, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= rateLimited {
+			w.WriteHeader(httputil.StatusTooManyRequests)
+			io.WriteString(w, `{"message": "You are being rate limited.", "retry_after": `+retryAfter+`}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint := api.EndpointWebhooks
+	api.EndpointWebhooks = server.URL + "/api/webhooks/"
+	t.Cleanup(func() { api.EndpointWebhooks = endpoint })
+
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	return cal, &requests
+}
+
+func TestTrackedCalendar_rateLimited(t *testing.T) {
+	cal, requests := newRateLimitedCalendar(t, 1, "0.01")
+
+	err := cal.execute(context.Background(), webhook.ExecuteData{Content: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestTrackedCalendar_rateLimitedRetries(t *testing.T) {
+	cal, requests := newRateLimitedCalendar(t, 100, "0.001")
+
+	err := cal.execute(context.Background(), webhook.ExecuteData{Content: "hi"})
+	assert.Error(t, err)
+	assert.Equal(t, int32(maxRateLimitRetries+1), requests.Load())
+}
+
+func TestTrackedCalendar_rateLimitedExpired(t *testing.T) {
+	cal, requests := newRateLimitedCalendar(t, 1, "60")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := cal.execute(ctx, webhook.ExecuteData{Content: "hi"})
+	assert.Error(t, err)
+	assert.True(t, sendExpired(ctx, err))
+	// Don't wait for a rate limit that outlasts the notification.
+	assert.NoError(t, ctx.Err())
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestNewTrackedCalendars_previous(t *testing.T) {
+	ctx := context.Background()
+
+	oldCfg := &config{
+		Calendars: []calendarConfig{
+			{ICalURL: "https://example.com/work.ics", WebhookURL: testWebhookURL},
+			{ICalURL: "https://example.com/home.ics", WebhookURL: testWebhookURL},
+		},
+	}
+	previous, err := newTrackedCalendars(ctx, oldCfg, time.UTC, nil)
+	assert.NoError(t, err)
+	previous[0].LastNotification = calendar.Notification{Calendar: previous[0]}
+
+	newCfg := &config{
+		Calendars: []calendarConfig{
+			{ICalURL: "https://example.com/gym.ics", WebhookURL: testWebhookURL},
+			{ICalURL: "https://example.com/work.ics", WebhookURL: testWebhookURL, MessageTemplate: "changed"},
+			{ICalURL: "https://example.com/home.ics", WebhookURL: testWebhookURL, Username: "me"},
+		},
+	}
+	calendars, err := newTrackedCalendars(ctx, newCfg, time.UTC, previous)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(calendars))
+
+	for i, cal := range calendars {
+		assert.Equal(t, i, cal.Position)
+	}
+
+	// The work calendar keeps its data and state.
+	work := calendars[1]
+	assert.True(t, work.Calendar == previous[0].Calendar)
+	assert.Equal(t, "changed", work.Config.MessageTemplate)
+	assert.False(t, work.LastNotification.IsZero())
+	assert.True(t, findCalendar(calendars, previous[0]) == work)
+
+	// The home calendar's credentials changed, so it must be fetched again.
+	assert.True(t, calendars[2].Calendar != previous[1].Calendar)
+
+	// The gym calendar is new.
+	assert.True(t, calendars[0].LastNotification.IsZero())
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := &config{
+		Calendars: []calendarConfig{{ICalURL: "https://example.com/work.ics"}},
+	}
+
+	cur := *old
+	cur.Calendars = []calendarConfig{{ICalURL: "https://example.com/home.ics"}}
+	assert.False(t, restartRequired(old, &cur))
+
+	cur.RemindIfUpdated = true
+	assert.True(t, restartRequired(old, &cur))
+}
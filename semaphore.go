@@ -0,0 +1,29 @@
+package main
+
+import "context"
+
+// semaphore limits the number of concurrent operations. Waiters acquire it in
+// the order that they started waiting.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return make(semaphore, n)
+}
+
+// acquire blocks until the semaphore is acquired or the context is done.
+func (s semaphore) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases a previously acquired semaphore.
+func (s semaphore) release() {
+	<-s
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSemaphore_ordering(t *testing.T) {
+	sem := newSemaphore(1)
+	ctx := context.Background()
+
+	// Hold the semaphore while the workers queue up.
+	if err := sem.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var inFlight, maxInFlight int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := sem.acquire(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			defer sem.release()
+
+			mu.Lock()
+			order = append(order, i)
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		// Give the worker time to start waiting.
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	sem.release()
+	wg.Wait()
+
+	if !slices.Equal(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("workers ran out of order: %v", order)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("expected at most 1 worker in flight, got %d", maxInFlight)
+	}
+}
+
+func TestSemaphore_cancel(t *testing.T) {
+	sem := newSemaphore(1)
+	if err := sem.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := sem.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// Values of calendarConfig.CancelledMessages.
+const (
+	cancelledMessagesKeep   = "keep"
+	cancelledMessagesEdit   = "edit"
+	cancelledMessagesDelete = "delete"
+)
+
+// validateCancelledMessages returns an error if s is not a valid value of
+// calendarConfig.CancelledMessages.
+func validateCancelledMessages(s string) error {
+	switch s {
+	case "", cancelledMessagesKeep, cancelledMessagesEdit, cancelledMessagesDelete:
+		return nil
+	default:
+		return errors.Errorf("unknown cancelled_messages %q", s)
+	}
+}
+
+// sentKey identifies an event occurrence that messages were sent for.
+type sentKey struct {
+	UID      string
+	StartsAt int64
+}
+
+func newSentKey(event calendar.Event) (sentKey, bool) {
+	if event.UID == "" {
+		return sentKey{}, false
+	}
+	return sentKey{event.UID, event.StartsAt.Unix()}, true
+}
+
+// sentMessages are the messages sent for an event occurrence.
+type sentMessages struct {
+	IDs    []discord.MessageID
+	EndsAt time.Time
+}
+
+// tracksSent returns true if the calendar needs to remember the messages it
+// sent, which is the case if they are updated when their event is cancelled.
+func (c *trackedCalendar) tracksSent() bool {
+	switch c.Config.CancelledMessages {
+	case cancelledMessagesEdit, cancelledMessagesDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordSent remembers the message that was sent for the notification. Events
+// that have ended by now are forgotten.
+func (c *trackedCalendar) recordSent(n calendar.Notification, id discord.MessageID, now time.Time) {
+	for key, sent := range c.SentMessages {
+		if sent.EndsAt.Before(now) {
+			delete(c.SentMessages, key)
+		}
+	}
+
+	key, ok := newSentKey(n.Event)
+	if !ok {
+		return
+	}
+
+	sent := c.SentMessages[key]
+	sent.IDs = append(sent.IDs, id)
+	sent.EndsAt = n.Event.EndsAt
+	c.SentMessages[key] = sent
+}
+
+// updateCancelled edits or deletes the messages that were sent for the event
+// of a cancellation notification, depending on the calendar's
+// cancelled_messages. Edited messages are replaced with the given message. It
+// returns false if no messages were updated, including for other kinds of
+// notifications, in which case the notification should be sent as usual.
+func (c *trackedCalendar) updateCancelled(ctx context.Context, n calendar.Notification, message *webhook.ExecuteData) (bool, error) {
+	if n.Kind != calendar.NotificationCancelled || !c.tracksSent() {
+		return false, nil
+	}
+
+	key, ok := newSentKey(n.Event)
+	if !ok {
+		return false, nil
+	}
+
+	sent, ok := c.SentMessages[key]
+	if !ok {
+		return false, nil
+	}
+	delete(c.SentMessages, key)
+
+	for _, id := range sent.IDs {
+		err := c.withWebhook(ctx, func(wh *webhook.Client) error {
+			if c.Config.CancelledMessages == cancelledMessagesDelete {
+				return deleteMessage(wh, c.Config.ThreadID, id)
+			}
+			_, err := editMessage(wh, c.Config.ThreadID, id, webhook.EditMessageData{
+				Content: option.NewNullableString(message.Content),
+				Embeds:  &message.Embeds,
+			})
+			return err
+		})
+		if err != nil {
+			return true, errors.Wrapf(err, "failed to update message %v", id)
+		}
+	}
+
+	return true, nil
+}
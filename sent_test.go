@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestTrackedCalendar_recordSent(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:        testWebhookURL,
+		CancelledMessages: cancelledMessagesEdit,
+	}, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, cal.tracksSent())
+
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	ended := calendar.Event{UID: "ended", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}
+	upcoming := calendar.Event{UID: "upcoming", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)}
+
+	cal.recordSent(calendar.Notification{Event: ended}, 1, now.Add(-3*time.Hour))
+	cal.recordSent(calendar.Notification{Event: upcoming}, 2, now)
+	cal.recordSent(calendar.Notification{Event: upcoming}, 3, now)
+	// Events without a UID can't be matched to their cancellation.
+	cal.recordSent(calendar.Notification{Event: calendar.Event{EndsAt: upcoming.EndsAt}}, 4, now)
+
+	key, _ := newSentKey(upcoming)
+	assert.Equal(t, map[sentKey]sentMessages{
+		key: {IDs: []discord.MessageID{2, 3}, EndsAt: upcoming.EndsAt},
+	}, cal.SentMessages)
+
+	// Only cancellations update the sent messages.
+	updated, err := cal.updateCancelled(context.Background(), calendar.Notification{Event: upcoming}, nil)
+	assert.NoError(t, err)
+	assert.False(t, updated)
+	assert.Equal(t, 1, len(cal.SentMessages))
+}
+
+func TestNewTrackedCalendar_unknownCancelledMessages(t *testing.T) {
+	_, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL:        testWebhookURL,
+		CancelledMessages: "strike",
+	}, time.UTC)
+	assert.Error(t, err)
+}
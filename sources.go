@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// calendarSourceConfig describes an external source of calendar
+// configurations. Exactly one of URL or Command must be set. The source must
+// produce a JSON array of calendar configurations.
+type calendarSourceConfig struct {
+	// URL is fetched using a GET request. The request times out like calendar
+	// fetches do by default.
+	URL string `json:"url"`
+	// Command is executed, and its standard output is used.
+	Command []string `json:"command"`
+}
+
+// loadCalendarSources loads the calendars from all of cfg's calendar sources
+// and appends them to cfg.Calendars.
+func loadCalendarSources(ctx context.Context, cfg *config) error {
+	for _, src := range cfg.CalendarSources {
+		calendars, err := src.load(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load calendar source %s", src)
+		}
+		cfg.Calendars = append(cfg.Calendars, calendars...)
+	}
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (s calendarSourceConfig) String() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return fmt.Sprintf("%q", s.Command)
+}
+
+func (s calendarSourceConfig) load(ctx context.Context) ([]calendarConfig, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case s.URL != "" && len(s.Command) > 0:
+		return nil, errors.New("only one of url and command may be set")
+	case s.URL != "":
+		data, err = fetchCalendarSource(ctx, s.URL)
+	case len(s.Command) > 0:
+		data, err = exec.CommandContext(ctx, s.Command[0], s.Command[1:]...).Output()
+		if err != nil {
+			err = errors.Wrap(err, "failed to run command")
+		}
+	default:
+		return nil, errors.New("either url or command must be set")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var calendars []calendarConfig
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&calendars); err != nil {
+		return nil, errors.Wrap(err, "failed to decode calendars")
+	}
+
+	return calendars, nil
+}
+
+func fetchCalendarSource(ctx context.Context, url string) ([]byte, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := calendar.DefaultHTTPClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status: %v", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
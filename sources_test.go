@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCalendarSourceConfig_url(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendars.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"ical_url": "https://example.com/work.ics"}]`))
+	}))
+	defer srv.Close()
+
+	src := calendarSourceConfig{URL: srv.URL + "/calendars.json"}
+	calendars, err := src.load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []calendarConfig{{ICalURL: "https://example.com/work.ics"}}, calendars)
+
+	src = calendarSourceConfig{URL: srv.URL + "/missing.json"}
+	_, err = src.load(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status: 404 Not Found")
+}
+
+func TestCalendarSourceConfig_command(t *testing.T) {
+	src := calendarSourceConfig{
+		Command: []string{"echo", `[{"ical_url": "https://example.com/home.ics"}]`},
+	}
+	calendars, err := src.load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []calendarConfig{{ICalURL: "https://example.com/home.ics"}}, calendars)
+
+	src = calendarSourceConfig{Command: []string{"false"}}
+	_, err = src.load(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to run command")
+
+	src = calendarSourceConfig{Command: []string{"echo", "not json"}}
+	_, err = src.load(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decode calendars")
+}
+
+func TestCalendarSourceConfig_invalid(t *testing.T) {
+	_, err := calendarSourceConfig{}.load(context.Background())
+	assert.Error(t, err)
+
+	_, err = calendarSourceConfig{
+		URL:     "https://example.com/calendars.json",
+		Command: []string{"echo", "[]"},
+	}.load(context.Background())
+	assert.Error(t, err)
+}
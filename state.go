@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// runState is the state that is persisted across restarts.
+type runState struct {
+	// LastProcessed is the reminder time up to which all notifications were
+	// processed, i.e. delivered or deliberately dropped.
+	LastProcessed time.Time `json:"last_processed"`
+
+	// firstFailed is the reminder time of the earliest notification that
+	// failed to be sent since startup. LastProcessed never advances to it, so
+	// that it is replayed after a restart.
+	firstFailed time.Time
+}
+
+// failed records that the notification due at remindedAt failed to be sent.
+func (s *runState) failed(remindedAt time.Time) {
+	if s.firstFailed.IsZero() || remindedAt.Before(s.firstFailed) {
+		s.firstFailed = remindedAt
+	}
+}
+
+// processed advances LastProcessed to remindedAt, the reminder time of a
+// processed notification. It returns false if LastProcessed didn't change,
+// because it is already later or because an earlier notification failed.
+func (s *runState) processed(remindedAt time.Time) bool {
+	if !remindedAt.After(s.LastProcessed) {
+		return false
+	}
+	if !s.firstFailed.IsZero() && !remindedAt.Before(s.firstFailed) {
+		return false
+	}
+	s.LastProcessed = remindedAt
+	return true
+}
+
+// loadRunState loads the state from the file at path. A missing file is not
+// an error and yields the zero state.
+func loadRunState(path string) (runState, error) {
+	var state runState
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return state, errors.Wrap(err, "failed to read state file")
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, errors.Wrap(err, "failed to decode state file")
+	}
+
+	return state, nil
+}
+
+// saveRunState saves the state to the file at path.
+func saveRunState(path string, state runState) error {
+	return errors.Wrap(writeJSONFile(path, state), "failed to save state")
+}
+
+// writeJSONFile writes v as JSON to the file at path. The file is replaced
+// atomically, so a crash never leaves it half-written.
+func writeJSONFile(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to replace file")
+	}
+
+	return nil
+}
+
+// replaySince returns the time since which missed reminders should be
+// replayed, given the last processed time and the maximum age of replayed
+// reminders. It returns the zero time if nothing was processed yet.
+func replaySince(lastProcessed, now time.Time, maxAge time.Duration) time.Time {
+	if lastProcessed.IsZero() {
+		return time.Time{}
+	}
+	if cutoff := now.Add(-maxAge); lastProcessed.Before(cutoff) {
+		return cutoff
+	}
+	return lastProcessed
+}
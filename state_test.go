@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRunState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.True(t, state.LastProcessed.IsZero())
+
+	lastProcessed := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	assert.NoError(t, saveRunState(path, runState{LastProcessed: lastProcessed}))
+
+	state, err = loadRunState(path)
+	assert.NoError(t, err)
+	assert.True(t, state.LastProcessed.Equal(lastProcessed))
+}
+
+func TestRunState_processed(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	var state runState
+	assert.True(t, state.processed(now))
+	assert.False(t, state.processed(now), "already processed")
+
+	state.failed(now.Add(10 * time.Minute))
+	assert.True(t, state.processed(now.Add(5*time.Minute)), "before the failure")
+	assert.False(t, state.processed(now.Add(10*time.Minute)), "at the failure")
+	assert.False(t, state.processed(now.Add(15*time.Minute)), "after the failure")
+	assert.True(t, state.LastProcessed.Equal(now.Add(5*time.Minute)))
+
+	// The failed notification is replayed after a restart.
+	since := replaySince(state.LastProcessed, now.Add(20*time.Minute), 24*time.Hour)
+	assert.True(t, since.Before(now.Add(10*time.Minute)))
+}
+
+func TestReplaySince(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		lastProcessed time.Time
+		expect        time.Time
+	}{
+		{"never", time.Time{}, time.Time{}},
+		{"recent", now.Add(-time.Hour), now.Add(-time.Hour)},
+		{"too_old", now.Add(-48 * time.Hour), now.Add(-24 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			since := replaySince(test.lastProcessed, now, 24*time.Hour)
+			assert.True(t, since.Equal(test.expect), "got %v", since)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// templateFuncs returns the functions available to message templates. Times
+// are compared in the given location, and now is used to get the current
+// time.
+func templateFuncs(location *time.Location, now func() time.Time) template.FuncMap {
+	days := func(t time.Time) int {
+		return calendar.DaysBetween(now().In(location), t.In(location))
+	}
+	return template.FuncMap{
+		"humanDuration":    humanDuration,
+		"discordTimestamp": discordTimestamp,
+		"relativeTime":     func(t time.Time) string { return relativeTime(t, now()) },
+		"localTime":        func(t time.Time) string { return localTime(t, location) },
+		"isToday":          func(t time.Time) bool { return days(t) == 0 },
+		"isTomorrow":       func(t time.Time) bool { return days(t) == 1 },
+		"relativeDay": func(t time.Time) string {
+			switch d := days(t); {
+			case d == -1:
+				return "yesterday"
+			case d == 0:
+				return "today"
+			case d == 1:
+				return "tomorrow"
+			case d > 1 && d < 7:
+				return t.In(location).Weekday().String()
+			default:
+				return t.In(location).Format("January 2")
+			}
+		},
+	}
+}
+
+// localTime formats t as a time of day in the given location, including the
+// zone abbreviation, e.g. "5:00 PM PST".
+func localTime(t time.Time, location *time.Location) string {
+	return t.In(location).Format("3:04 PM MST")
+}
+
+// discordTimestampStyles are the styles of Discord timestamps, e.g. "R" for
+// a relative time like "in 2 hours".
+const discordTimestampStyles = "tTdDfFR"
+
+// discordTimestamp formats t as a Discord timestamp, which is shown in each
+// user's own timezone. The style may be empty for Discord's default style.
+func discordTimestamp(t time.Time, style string) (string, error) {
+	if style == "" {
+		return fmt.Sprintf("<t:%d>", t.Unix()), nil
+	}
+	if len(style) != 1 || !strings.Contains(discordTimestampStyles, style) {
+		return "", errors.Errorf("unknown timestamp style %q", style)
+	}
+	return fmt.Sprintf("<t:%d:%s>", t.Unix(), style), nil
+}
+
+// relativeTime describes t relative to now, e.g. "in 2 hours" or "5 minutes
+// ago".
+func relativeTime(t, now time.Time) string {
+	d := t.Sub(now).Round(time.Minute)
+	switch {
+	case d > 0:
+		return "in " + humanDuration(d)
+	case d < 0:
+		return humanDuration(-d) + " ago"
+	default:
+		return "now"
+	}
+}
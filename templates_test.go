@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	funcs := templateFuncs(time.UTC, func() time.Time { return now })
+
+	tests := []struct {
+		name   string
+		tmpl   string
+		expect string
+	}{
+		{"humanDuration", `{{ humanDuration .Sub }}`, "2 hours 30 minutes"},
+		{"discordTimestamp", `{{ discordTimestamp .At "R" }}`, "<t:1690918200:R>"},
+		{"discordTimestampDefault", `{{ discordTimestamp .At "" }}`, "<t:1690918200>"},
+		{"relativeTimeFuture", `{{ relativeTime .At }}`, "in 2 hours 30 minutes"},
+		{"relativeTimePast", `{{ relativeTime .Before }}`, "45 minutes ago"},
+	}
+
+	data := map[string]any{
+		"Sub":    150 * time.Minute,
+		"At":     now.Add(150 * time.Minute),
+		"Before": now.Add(-45 * time.Minute),
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := template.New("").Funcs(funcs).Parse(test.tmpl)
+			assert.NoError(t, err)
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, data))
+			assert.Equal(t, test.expect, sb.String())
+		})
+	}
+}
+
+func TestDiscordTimestamp_invalidStyle(t *testing.T) {
+	_, err := discordTimestamp(time.Unix(0, 0), "X")
+	assert.Error(t, err)
+}
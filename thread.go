@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+)
+
+// webhookMessageURL returns the URL of a message sent by the webhook. Messages
+// in threads can only be accessed by specifying their thread.
+func webhookMessageURL(c *webhook.Client, threadID discord.ChannelID, messageID discord.MessageID) string {
+	u := api.EndpointWebhooks + c.ID.String() + "/" + c.Token + "/messages/" + messageID.String()
+	if threadID.IsValid() {
+		u += "?thread_id=" + threadID.String()
+	}
+	return u
+}
+
+// editMessage is like webhook.Client.EditMessage, but also works for messages
+// in the given thread, if valid.
+func editMessage(c *webhook.Client, threadID discord.ChannelID, messageID discord.MessageID, data webhook.EditMessageData) (*discord.Message, error) {
+	if !threadID.IsValid() {
+		return c.EditMessage(messageID, data)
+	}
+
+	var msg *discord.Message
+	return msg, sendpart.PATCH(c.Client, data, &msg, webhookMessageURL(c, threadID, messageID))
+}
+
+// deleteMessage is like webhook.Client.DeleteMessage, but also works for
+// messages in the given thread, if valid.
+func deleteMessage(c *webhook.Client, threadID discord.ChannelID, messageID discord.MessageID) error {
+	if !threadID.IsValid() {
+		return c.DeleteMessage(messageID)
+	}
+	return c.FastRequest("DELETE", webhookMessageURL(c, threadID, messageID))
+}
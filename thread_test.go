@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestCreateNotificationMessage_threadID(t *testing.T) {
+	cal, err := newTrackedCalendar(context.Background(), calendarConfig{
+		WebhookURL: testWebhookURL,
+		ThreadID:   1234,
+	}, time.UTC)
+	assert.NoError(t, err)
+
+	startsAt := time.Date(2023, time.August, 1, 17, 0, 0, 0, time.UTC)
+	message, err := createNotificationMessage(cal, calendar.Notification{
+		Calendar:   cal,
+		Event:      calendar.Event{StartsAt: startsAt, Summary: "Meeting"},
+		RemindedAt: startsAt.Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, discord.CommandID(1234), message.ThreadID)
+}
+
+func TestWebhookMessageURL(t *testing.T) {
+	c, err := webhook.NewFromURL(testWebhookURL)
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		"https://discord.com/api/v9/webhooks/1/token/messages/5",
+		webhookMessageURL(c, 0, 5))
+	assert.Equal(t,
+		"https://discord.com/api/v9/webhooks/1/token/messages/5?thread_id=1234",
+		webhookMessageURL(c, 1234, 5))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/pkg/errors"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+// Validate checks the config for mistakes that would otherwise only show up
+// at runtime, e.g. when the first notification is sent. All problems are
+// reported at once, each with the calendar that it is about.
+func (c *config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	durations := []struct {
+		name string
+		d    durationValue
+	}{
+		{"refresh_frequency", c.RefreshFrequency},
+		{"lookahead_window", c.LookaheadWindow},
+		{"min_event_duration", c.MinEventDuration},
+		{"max_event_duration", c.MaxEventDuration},
+		{"announce_window", c.AnnounceWindow},
+		{"retention", c.Retention},
+		{"batch_window", c.BatchWindow},
+		{"replay_max_age", c.ReplayMaxAge},
+		{"past_grace", c.PastGrace},
+		{"deliver_timeout", c.DeliverTimeout},
+	}
+	for i, d := range c.EventNotifications {
+		durations = append(durations, struct {
+			name string
+			d    durationValue
+		}{fmt.Sprintf("event_notifications[%d]", i), d})
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			addf("%s: must not be negative, got %v", d.name, d.d.Duration())
+		}
+	}
+
+	if _, err := parseDefaultRemindersMode(c.DefaultRemindersMode); err != nil {
+		addf("default_reminders_mode: %v", err)
+	}
+
+	for i, cal := range c.Calendars {
+		for _, err := range cal.validate(cal.location(c.Timezone.Location())) {
+			addf("calendars[%d] (%s): %v", i, cal.ICalURL, err)
+		}
+		// Cancellations are only seen if updated events are tracked.
+		switch cal.CancelledMessages {
+		case cancelledMessagesEdit, cancelledMessagesDelete:
+			if !c.RemindIfUpdated {
+				addf("calendars[%d] (%s): cancelled_messages %q requires remind_if_updated",
+					i, cal.ICalURL, cal.CancelledMessages)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid config:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// validate returns the problems with the calendar's config.
+func (c calendarConfig) validate(location *time.Location) []error {
+	var errs []error
+
+	if err := calendar.ValidateICalURL(c.ICalURL); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid ical_url"))
+	}
+
+	if c.WebhookURL == "" {
+		errs = append(errs, errors.New("missing webhook_url"))
+	} else if _, err := webhook.NewFromURL(c.WebhookURL); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid webhook_url"))
+	}
+
+	templates := []struct {
+		name string
+		text string
+	}{
+		{"message_template", c.MessageTemplate},
+		{"embed_url_template", c.EmbedURLTemplate},
+		{"webhook_username", c.WebhookUsername},
+	}
+	for _, t := range templates {
+		if err := validateTemplate(t.text, c, location); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", t.name))
+		}
+	}
+
+	if c.WebhookAvatarURL != "" {
+		if err := validateHTTPURL(c.WebhookAvatarURL); err != nil {
+			errs = append(errs, errors.Wrap(err, "invalid webhook_avatar_url"))
+		}
+	}
+
+	if err := validateCancelledMessages(c.CancelledMessages); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateDestinations(c); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid destinations"))
+	}
+
+	if _, err := newEmbedStyles(c.Embed.Color, c.EmbedStyles); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid embed_styles"))
+	}
+
+	if c.ExcludeSummary != "" {
+		if _, err := regexp.Compile(c.ExcludeSummary); err != nil {
+			errs = append(errs, errors.Wrap(err, "invalid exclude_summary"))
+		}
+	}
+
+	if _, err := compileReminderPattern(c.ReminderPattern); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid reminder_pattern"))
+	}
+
+	if err := c.Embed.validate(); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid embed"))
+	}
+
+	durations := []struct {
+		name string
+		d    durationValue
+	}{
+		{"fetch_timeout", c.FetchTimeout},
+		{"request_timeout", c.RequestTimeout},
+		{"live_countdown", c.LiveCountdown},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			errs = append(errs, errors.Errorf("%s: must not be negative, got %v", d.name, d.d.Duration()))
+		}
+	}
+
+	return errs
+}
+
+// validateTemplate parses the template and executes it against an example
+// notification, which catches references to fields that don't exist.
+func validateTemplate(text string, cfg calendarConfig, location *time.Location) error {
+	tmpl, err := template.New("").
+		Funcs(templateFuncs(location, time.Now)).
+		Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(io.Discard, exampleNotification(cfg, location))
+}
+
+// exampleNotification returns a notification that is representative of the
+// ones sent for the calendar.
+func exampleNotification(cfg calendarConfig, location *time.Location) calendar.Notification {
+	startsAt := time.Now().In(location).Truncate(time.Hour).Add(time.Hour)
+	return calendar.Notification{
+		Calendar: &trackedCalendar{
+			Calendar: cfg.onlineCalendar(),
+			Location: location,
+			Config:   cfg,
+		},
+		Event: calendar.Event{
+			UID:      "example@example.com",
+			StartsAt: startsAt,
+			EndsAt:   startsAt.Add(time.Hour),
+			Summary:  "Example Event",
+			Status:   calendar.EventConfirmed,
+		},
+		RemindedAt: startsAt.Add(-15 * time.Minute),
+		Action:     calendar.ReminderActionDisplay,
+	}
+}
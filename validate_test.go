@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"libdb.so/discord-ical-reminder/calendar"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := calendarConfig{
+		ICalURL:         "https://example.com/calendar.ics",
+		WebhookURL:      testWebhookURL,
+		MessageTemplate: "{{.Event.Summary}} starts {{relativeTime .Event.StartsAt}}",
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		local := valid
+		local.ICalURL = "file:///srv/calendar.ics"
+
+		cfg := config{Calendars: []calendarConfig{valid, local}}
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("cancelled_messages", func(t *testing.T) {
+		deleting := valid
+		deleting.CancelledMessages = cancelledMessagesDelete
+
+		cfg := config{Calendars: []calendarConfig{deleting}}
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(),
+			`calendars[0] (https://example.com/calendar.ics): cancelled_messages "delete" requires remind_if_updated`)
+
+		cfg.RemindIfUpdated = true
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		badURL := valid
+		badURL.ICalURL = "ftp://example.com/calendar.ics"
+		badURL.WebhookURL = ""
+
+		badTemplate := valid
+		badTemplate.MessageTemplate = "{{.Event.Nonexistent}}"
+		badTemplate.RequestTimeout = durationValue(-time.Second)
+		badTemplate.Embed.Fields = map[string]bool{"start": false}
+		badTemplate.ReminderPattern = `remind (\d+) (minutes|hours) before`
+
+		badOptions := valid
+		badOptions.WebhookAvatarURL = "avatar.png"
+		badOptions.CancelledMessages = "strike"
+		badOptions.Destinations = map[calendar.ReminderAction]string{"EMAIL": destinationEmail}
+		badOptions.EmbedStyles = map[string]embedStyleConfig{"bogus": {}}
+		badOptions.ExcludeSummary = "(unclosed"
+
+		cfg := config{
+			Calendars:            []calendarConfig{valid, badURL, badTemplate, badOptions},
+			RefreshFrequency:     durationValue(-time.Minute),
+			PastGrace:            durationValue(-time.Minute),
+			DeliverTimeout:       durationValue(-time.Minute),
+			DefaultRemindersMode: "never",
+		}
+
+		err := cfg.Validate()
+		assert.Error(t, err)
+
+		msg := err.Error()
+		for _, expect := range []string{
+			"refresh_frequency: must not be negative",
+			"past_grace: must not be negative",
+			"deliver_timeout: must not be negative",
+			`default_reminders_mode: unknown default reminders mode "never"`,
+			`calendars[1] (ftp://example.com/calendar.ics): invalid ical_url: unsupported scheme "ftp"`,
+			"calendars[1] (ftp://example.com/calendar.ics): missing webhook_url",
+			"calendars[2] (https://example.com/calendar.ics): invalid message_template",
+			"calendars[2] (https://example.com/calendar.ics): request_timeout: must not be negative",
+			`calendars[2] (https://example.com/calendar.ics): invalid embed: unknown field "start"`,
+			"calendars[2] (https://example.com/calendar.ics): invalid reminder_pattern: reminder pattern must have exactly one capture group",
+			`calendars[3] (https://example.com/calendar.ics): invalid webhook_avatar_url: "avatar.png" is not an HTTP URL`,
+			`calendars[3] (https://example.com/calendar.ics): unknown cancelled_messages "strike"`,
+			`calendars[3] (https://example.com/calendar.ics): invalid destinations: action "EMAIL" is sent by email, but email is not configured`,
+			`calendars[3] (https://example.com/calendar.ics): invalid embed_styles: unknown embed style "bogus"`,
+			"calendars[3] (https://example.com/calendar.ics): invalid exclude_summary",
+		} {
+			assert.Contains(t, msg, expect)
+		}
+		assert.NotContains(t, msg, "calendars[0]")
+	})
+}